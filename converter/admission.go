@@ -0,0 +1,198 @@
+package converter
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/whisper-darkly/sticky-converter/internal/sysinfo"
+)
+
+// admissionConfig holds files back while resources are short. Every
+// threshold that is set must be met before a file is submitted and again
+// before its worker starts.
+type admissionConfig struct {
+	MinFree         int64   `json:"min_free,omitempty"`          // bytes that must stay free where output is written
+	SizeRatio       float64 `json:"size_ratio,omitempty"`        // also reserve input size × this for the output
+	MaxLoad         float64 `json:"max_load,omitempty"`          // highest one-minute load average
+	MinMemAvailable int64   `json:"min_mem_available,omitempty"` // lowest MemAvailable, in bytes
+}
+
+// Hold reasons recorded on queued files.
+const (
+	holdDisk   = "waiting for disk"
+	holdLoad   = "waiting for load"
+	holdMemory = "waiting for memory"
+)
+
+// admission applies an admissionConfig. The output still to be written by
+// conversions this process has started counts against the free space, so
+// several large jobs starting at once cannot all claim the same bytes.
+type admission struct {
+	cfg     *admissionConfig
+	startMu sync.Mutex             // serialises start, so concurrent starts see each other's reservations
+	mu      sync.Mutex             // guards running
+	running map[string]reservation // by work path
+}
+
+// reservation is the estimated output of one running conversion.
+type reservation struct {
+	disks []string // sysinfo.Disk IDs it writes to
+	bytes int64
+}
+
+func newAdmission(cfg *admissionConfig) *admission {
+	return &admission{cfg: cfg, running: make(map[string]reservation)}
+}
+
+// admissionBatch checks a round of files: the load and memory readings are
+// taken once, and the space estimated for each admitted file is counted
+// against the ones after it. A nil *admissionBatch admits everything.
+type admissionBatch struct {
+	a        *admission
+	global   string           // load or memory hold reason, if any
+	promised map[string]int64 // bytes by disk
+}
+
+func (a *admission) batch() *admissionBatch {
+	if a == nil {
+		return nil
+	}
+	b := &admissionBatch{a: a, promised: make(map[string]int64)}
+	if limit := a.cfg.MaxLoad; limit > 0 {
+		if load, err := sysinfo.LoadAverage(); err != nil {
+			log.Printf("[converter] read load average: %v", err)
+		} else if load > limit {
+			b.global = fmt.Sprintf("%s (load above %.2f)", holdLoad, limit)
+		}
+	}
+	if limit := a.cfg.MinMemAvailable; limit > 0 && b.global == "" {
+		if mem, err := sysinfo.MemAvailable(); err != nil {
+			log.Printf("[converter] read available memory: %v", err)
+		} else if int64(mem) < limit {
+			b.global = fmt.Sprintf("%s (needs %s available)", holdMemory, formatBytes(limit))
+		}
+	}
+	return b
+}
+
+// admit returns why inputPath cannot be converted into dirs now, or "" if it
+// can. An admitted file's estimated output is counted against later files in
+// the batch and returned as a reservation.
+func (b *admissionBatch) admit(inputPath string, dirs []string) (string, reservation) {
+	if b == nil {
+		return "", reservation{}
+	}
+	if b.global != "" {
+		return b.global, reservation{}
+	}
+	var est int64
+	if b.a.cfg.SizeRatio > 0 {
+		if fi, err := os.Stat(inputPath); err == nil {
+			est = int64(float64(fi.Size()) * b.a.cfg.SizeRatio)
+		}
+	}
+	if b.a.cfg.MinFree <= 0 && est == 0 {
+		return "", reservation{}
+	}
+
+	res := reservation{bytes: est}
+	seen := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		disk, err := sysinfo.DiskFree(dir)
+		if err != nil {
+			log.Printf("[converter] read free space of %s: %v", dir, err)
+			continue
+		}
+		if seen[disk.ID] {
+			continue
+		}
+		seen[disk.ID] = true
+		need := b.a.cfg.MinFree + est
+		avail := int64(disk.Free) - b.a.outstanding(disk.ID) - b.promised[disk.ID]
+		if avail < need {
+			return fmt.Sprintf("%s (needs %s free in %s)", holdDisk, formatBytes(need), dir), reservation{}
+		}
+		res.disks = append(res.disks, disk.ID)
+	}
+	for _, id := range res.disks {
+		b.promised[id] += est
+	}
+	return "", res
+}
+
+// outstanding returns the output running conversions are expected to write
+// to disk beyond what they already have.
+func (a *admission) outstanding(disk string) int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var total int64
+	for workPath, r := range a.running {
+		if !slices.Contains(r.disks, disk) {
+			continue
+		}
+		left := r.bytes
+		if fi, err := os.Stat(workPath); err == nil {
+			left -= fi.Size()
+		}
+		if left > 0 {
+			total += left
+		}
+	}
+	return total
+}
+
+// start admits a conversion that is about to write workPath and keeps its
+// reservation until the returned release is called.
+func (a *admission) start(inputPath, workPath string, dirs []string) (reason string, release func()) {
+	if a == nil {
+		return "", func() {}
+	}
+	a.startMu.Lock()
+	defer a.startMu.Unlock()
+	reason, res := a.batch().admit(inputPath, dirs)
+	if reason != "" {
+		return reason, nil
+	}
+	a.mu.Lock()
+	a.running[workPath] = res
+	a.mu.Unlock()
+	return "", func() {
+		a.mu.Lock()
+		delete(a.running, workPath)
+		a.mu.Unlock()
+	}
+}
+
+// outputDirs returns the directories a conversion of target writes to.
+func (h *converterHandler) outputDirs(target string) []string {
+	dirs := []string{filepath.Dir(target)}
+	if h.cfg.StagingDir != "" {
+		dirs = append(dirs, h.cfg.StagingDir)
+	}
+	return dirs
+}
+
+// hold records why a queued file is not being submitted or started.
+func (h *converterHandler) hold(path, reason string) {
+	if err := h.store.SetHoldReason(path, reason); err != nil {
+		log.Printf("[converter] record hold reason %s: %v", path, err)
+	}
+}
+
+// formatBytes formats n with a binary unit, e.g. "12.0 GiB".
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,379 @@
+package converter
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// apiServer serves the converter's runtime HTTP API on one address. Every
+// pipeline configured with the same api_listen shares it, and must use the
+// same api_token.
+type apiServer struct {
+	token     string // required as a bearer token when set
+	doc       []byte // OpenAPI document, built from apiRoutes
+	mu        sync.RWMutex
+	pipelines map[string]*converterHandler
+}
+
+var (
+	apiMu      sync.Mutex
+	apiServers = map[string]*apiServer{}
+)
+
+// registerAPI adds h to the API server for addr, starting the server on first
+// use. The server runs for the life of the process.
+func registerAPI(addr, token string, h *converterHandler) error {
+	apiMu.Lock()
+	defer apiMu.Unlock()
+	srv := apiServers[addr]
+	if srv != nil && srv.token != token {
+		return fmt.Errorf("api_listen %s is shared with a pipeline using a different api_token", addr)
+	}
+	if srv == nil {
+		doc, err := openAPIDocument(token != "")
+		if err != nil {
+			return err
+		}
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return err
+		}
+		srv = &apiServer{token: token, doc: doc, pipelines: make(map[string]*converterHandler)}
+		mux := http.NewServeMux()
+		srv.routes(mux)
+		go func() {
+			if err := http.Serve(ln, mux); err != nil {
+				log.Printf("[converter] api server %s: %v", addr, err)
+			}
+		}()
+		apiServers[addr] = srv
+		log.Printf("[converter] api listening on %s", ln.Addr())
+	}
+	srv.mu.Lock()
+	srv.pipelines[h.actionName] = h
+	srv.mu.Unlock()
+	return nil
+}
+
+// loopbackAddr reports whether addr, a host:port, only accepts connections
+// from this machine. An empty host listens on every interface.
+func loopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// unregisterAPI removes h from the API server for addr.
+func unregisterAPI(addr string, h *converterHandler) {
+	apiMu.Lock()
+	srv := apiServers[addr]
+	apiMu.Unlock()
+	if srv == nil {
+		return
+	}
+	srv.mu.Lock()
+	if srv.pipelines[h.actionName] == h {
+		delete(srv.pipelines, h.actionName)
+	}
+	srv.mu.Unlock()
+}
+
+// apiRoute is one route of the API. Its doc is the OpenAPI operation object
+// for the route, so the served routes and the document cannot drift apart.
+type apiRoute struct {
+	method  string
+	path    string // net/http pattern; {x} segments are path parameters
+	handler func(s *apiServer, w http.ResponseWriter, r *http.Request)
+	doc     string
+}
+
+// apiRoutes are the routes every apiServer serves, and what openAPIDocument
+// describes. Schemas and responses referenced by the docs are defined in
+// openAPIComponents.
+var apiRoutes = []apiRoute{
+	{"GET", "/pipelines", (*apiServer).listPipelines, `{
+		"summary": "List the pipelines served on this address",
+		"responses": {
+			"200": {"description": "Pipeline names", "content": {"application/json": {"schema": {
+				"type": "object", "properties": {"pipelines": {"type": "array", "items": {"type": "string"}}}}}}}
+		}}`},
+	{"GET", "/pipelines/{name}/extra", (*apiServer).getExtra, `{
+		"summary": "Read a pipeline's extra values",
+		"responses": {"200": {"$ref": "#/components/responses/extra"}, "404": {"$ref": "#/components/responses/error"}}}`},
+	{"PUT", "/pipelines/{name}/extra", (*apiServer).putExtra, `{
+		"summary": "Replace the runtime extra override",
+		"requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object"}}}},
+		"responses": {"200": {"$ref": "#/components/responses/extra"}, "400": {"$ref": "#/components/responses/error"}, "404": {"$ref": "#/components/responses/error"}}}`},
+	{"PATCH", "/pipelines/{name}/extra", (*apiServer).patchExtra, `{
+		"summary": "Merge keys into the runtime extra override; null removes a key",
+		"requestBody": {"required": true, "content": {"application/json": {"schema": {"type": "object"}}}},
+		"responses": {"200": {"$ref": "#/components/responses/extra"}, "400": {"$ref": "#/components/responses/error"}, "404": {"$ref": "#/components/responses/error"}}}`},
+	{"GET", "/pipelines/{name}/files", (*apiServer).listFiles, `{
+		"summary": "List a pipeline's files",
+		"parameters": [
+			{"name": "status", "in": "query", "description": "Comma-separated statuses", "schema": {"type": "string", "example": "errored,failed"}},
+			{"name": "prefix", "in": "query", "description": "Input path prefix", "schema": {"type": "string"}},
+			{"name": "min_errors", "in": "query", "schema": {"type": "integer", "minimum": 0}},
+			{"name": "max_errors", "in": "query", "schema": {"type": "integer", "minimum": 0}},
+			{"name": "sort", "in": "query", "schema": {"type": "string", "default": "queued_at",
+				"enum": ["path", "status", "queued_at", "started_at", "completed_at", "last_attempted_at", "error_count"]}},
+			{"name": "order", "in": "query", "schema": {"type": "string", "enum": ["asc", "desc"], "default": "asc"}},
+			{"name": "limit", "in": "query", "schema": {"type": "integer", "default": 100, "maximum": 1000}},
+			{"name": "offset", "in": "query", "schema": {"type": "integer", "default": 0}}
+		],
+		"responses": {
+			"200": {"description": "One page of files", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/FileList"}}}},
+			"400": {"$ref": "#/components/responses/error"},
+			"404": {"$ref": "#/components/responses/error"}
+		}}`},
+	{"POST", "/pipelines/{name}/files/{op}", (*apiServer).fileOp, `{
+		"summary": "Apply an operation to the selected files",
+		"requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/FileSelector"}}}},
+		"responses": {
+			"200": {"description": "What was applied and skipped", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/FileOpResult"}}}},
+			"400": {"$ref": "#/components/responses/error"},
+			"404": {"$ref": "#/components/responses/error"}
+		}}`},
+	{"GET", "/pipelines/{name}/stats", (*apiServer).pipelineStats, `{
+		"summary": "Count a pipeline's files by status",
+		"responses": {
+			"200": {"description": "Counts", "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Stats"}}}},
+			"404": {"$ref": "#/components/responses/error"}
+		}}`},
+	{"GET", "/pipelines/{name}/state", (*apiServer).getState, `{
+		"summary": "Read a pipeline's state",
+		"responses": {"200": {"$ref": "#/components/responses/state"}, "404": {"$ref": "#/components/responses/error"}}}`},
+	{"PUT", "/pipelines/{name}/state", (*apiServer).putState, `{
+		"summary": "Run, pause, or drain a pipeline",
+		"requestBody": {"required": true, "content": {"application/json": {"schema": {
+			"type": "object", "required": ["state"], "properties": {"state": {"$ref": "#/components/schemas/PipelineState"}}}}}},
+		"responses": {"200": {"$ref": "#/components/responses/state"}, "400": {"$ref": "#/components/responses/error"}, "404": {"$ref": "#/components/responses/error"}}}`},
+	{"GET", "/stats", (*apiServer).allStats, `{
+		"summary": "Count the files of every pipeline on this address by status",
+		"responses": {
+			"200": {"description": "Counts per pipeline", "content": {"application/json": {"schema": {
+				"type": "object", "properties": {"pipelines": {"type": "array", "items": {"$ref": "#/components/schemas/Stats"}}}}}}}
+		}}`},
+	{"GET", "/openapi.json", (*apiServer).openAPI, `{
+		"summary": "This document",
+		"responses": {"200": {"description": "OpenAPI 3 document", "content": {"application/json": {"schema": {"type": "object"}}}}}}`},
+}
+
+func (s *apiServer) routes(mux *http.ServeMux) {
+	for _, route := range apiRoutes {
+		handler := route.handler
+		mux.Handle(route.method+" "+route.path, s.authorized(func(w http.ResponseWriter, r *http.Request) {
+			handler(s, w, r)
+		}))
+	}
+}
+
+// authorized wraps next to require the server's token, if it has one, as
+// "Authorization: Bearer <token>".
+func (s *apiServer) authorized(next http.HandlerFunc) http.Handler {
+	if s.token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong api token"))
+			return
+		}
+		next(w, r)
+	})
+}
+
+// pipeline returns the pipeline named in the request path, writing a 404 if
+// there is none.
+func (s *apiServer) pipeline(w http.ResponseWriter, r *http.Request) *converterHandler {
+	s.mu.RLock()
+	h := s.pipelines[r.PathValue("name")]
+	s.mu.RUnlock()
+	if h == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown pipeline %q", r.PathValue("name")))
+	}
+	return h
+}
+
+func (s *apiServer) listPipelines(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	names := make([]string, 0, len(s.pipelines))
+	for name := range s.pipelines {
+		names = append(names, name)
+	}
+	s.mu.RUnlock()
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, map[string]any{"pipelines": names})
+}
+
+// extraResponse is returned by every extra endpoint.
+type extraResponse struct {
+	Config   map[string]any `json:"config"`   // config.extra from YAML
+	Override map[string]any `json:"override"` // runtime override in pipeline_config
+	Merged   map[string]any `json:"merged"`   // what templates see as {{.Extra}}
+}
+
+func (s *apiServer) getExtra(w http.ResponseWriter, r *http.Request) {
+	h := s.pipeline(w, r)
+	if h == nil {
+		return
+	}
+	writeExtra(w, h)
+}
+
+// putExtra replaces the override with the request body, a JSON object.
+func (s *apiServer) putExtra(w http.ResponseWriter, r *http.Request) {
+	h := s.pipeline(w, r)
+	if h == nil {
+		return
+	}
+	var override map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&override); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("body must be a JSON object: %w", err))
+		return
+	}
+	if err := h.setExtraOverride(override); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeExtra(w, h)
+}
+
+// patchExtra merges the request body into the override; null values remove
+// keys.
+func (s *apiServer) patchExtra(w http.ResponseWriter, r *http.Request) {
+	h := s.pipeline(w, r)
+	if h == nil {
+		return
+	}
+	var patch map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("body must be a JSON object: %w", err))
+		return
+	}
+	s.mu.Lock() // serialise read-modify-write of overrides
+	defer s.mu.Unlock()
+	override, err := h.extraOverride()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for k, v := range patch {
+		if v == nil {
+			delete(override, k)
+		} else {
+			override[k] = v
+		}
+	}
+	if err := h.setExtraOverride(override); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeExtra(w, h)
+}
+
+// fileSelector picks the files an operation applies to: the listed paths, or
+// every file of the pipeline matching glob and status.
+type fileSelector struct {
+	Paths  []string `json:"paths,omitempty"`
+	Glob   string   `json:"glob,omitempty"`   // doublestar pattern matched against the input path
+	Status string   `json:"status,omitempty"` // e.g. "errored"
+}
+
+type skippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+type fileOpResponse struct {
+	Applied []string      `json:"applied"`
+	Skipped []skippedFile `json:"skipped"`
+}
+
+// fileOp applies one of fileOps to the selected files of a pipeline.
+func (s *apiServer) fileOp(w http.ResponseWriter, r *http.Request) {
+	h := s.pipeline(w, r)
+	if h == nil {
+		return
+	}
+	op := fileOps[r.PathValue("op")]
+	if op == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("unknown operation %q", r.PathValue("op")))
+		return
+	}
+	var sel fileSelector
+	if err := json.NewDecoder(r.Body).Decode(&sel); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("body must be a JSON object: %w", err))
+		return
+	}
+	if len(sel.Paths) == 0 && sel.Glob == "" && sel.Status == "" {
+		writeError(w, http.StatusBadRequest, errors.New("select files with paths, glob, or status"))
+		return
+	}
+	if sel.Glob != "" && !doublestar.ValidatePattern(sel.Glob) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid glob %q", sel.Glob))
+		return
+	}
+	files, skipped, err := h.selectFiles(sel)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp := fileOpResponse{Applied: []string{}, Skipped: []skippedFile{}}
+	resp.Skipped = append(resp.Skipped, skipped...)
+	for _, tf := range files {
+		if err := op(h, tf); err != nil {
+			resp.Skipped = append(resp.Skipped, skippedFile{Path: tf.Path, Reason: err.Error()})
+			continue
+		}
+		resp.Applied = append(resp.Applied, tf.Path)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeExtra(w http.ResponseWriter, h *converterHandler) {
+	override, err := h.extraOverride()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	merged, err := h.extra()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cfg := h.cfg.Extra
+	if cfg == nil {
+		cfg = map[string]any{}
+	}
+	writeJSON(w, http.StatusOK, extraResponse{Config: cfg, Override: override, Merged: merged})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("[converter] write api response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
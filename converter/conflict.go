@@ -0,0 +1,123 @@
+package converter
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Policies for an output path that already exists (on_conflict).
+const (
+	conflictOverwrite = "overwrite"
+	conflictSkip      = "skip"
+	conflictFail      = "fail"
+	conflictSuffix    = "suffix"
+)
+
+// handleExistingTarget applies the skip and fail policies when outputPath
+// already exists: skip marks the input (or, in a multi-output pipeline, the
+// output) completed without converting it, fail marks it errored. It reports
+// whether the output was dealt with. A replaced input overwrites the outputs
+// of its previous version whatever the policy.
+func (h *converterHandler) handleExistingTarget(inputPath string, out *outputConfig, outputPath string) bool {
+	if h.cfg.OnConflict != conflictSkip && h.cfg.OnConflict != conflictFail {
+		return false
+	}
+	if _, err := os.Lstat(outputPath); err != nil {
+		return false
+	}
+	if tf, err := h.store.GetByPath(inputPath); err == nil && tf.Replacing {
+		return false
+	}
+
+	if h.cfg.OnConflict == conflictSkip {
+		log.Printf("[converter] %s already exists; skipping %s", outputPath, inputPath)
+		if h.multiOutput() {
+			if err := h.store.MarkOutputCompleted(inputPath, out.Name); err != nil {
+				log.Printf("[converter] mark output %s completed %s: %v", out.Name, inputPath, err)
+			}
+			h.settleOutputs(inputPath, false)
+		} else if err := h.store.MarkCompleted(inputPath); err != nil {
+			log.Printf("[converter] mark completed %s: %v", inputPath, err)
+		}
+		return true
+	}
+	msg := fmt.Sprintf("target %s already exists", outputPath)
+	if h.multiOutput() {
+		h.finishOutput(inputPath, out, msg)
+		return true
+	}
+	if err := h.store.MarkErrored(inputPath, msg); err != nil {
+		log.Printf("[converter] mark errored %s: %v", inputPath, err)
+	}
+	h.failIfExhausted(inputPath)
+	return true
+}
+
+// claimedBy returns the file that holds target ahead of path, or "". An
+// in_flight file always holds it. A queued file only does while it is still
+// to be converted itself: when it was found by this scan, or, outside a full
+// scan (scanned is nil), while its input exists. So the stale row of a
+// deleted, renamed, or excluded input cannot hold a target forever.
+func (h *converterHandler) claimedBy(target, path string, scanned map[string]bool) (string, error) {
+	claims, err := h.store.TargetClaims(target, path)
+	if err != nil {
+		return "", err
+	}
+	for _, c := range claims {
+		switch {
+		case c.Status == "in_flight":
+		case scanned != nil:
+			if !scanned[c.Path] {
+				continue
+			}
+		default:
+			if _, err := os.Stat(c.Path); err != nil {
+				continue
+			}
+		}
+		return c.Path, nil
+	}
+	return "", nil
+}
+
+// reserveSuffixPath picks the path a suffix-mode conversion of outputPath
+// writes to and holds it until the returned release is called, so running
+// conversions never pick the same free name, even before their output (or,
+// with atomic_output, its staged file) appears.
+func (h *converterHandler) reserveSuffixPath(outputPath string) (string, func(), error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	path, err := freeSuffixPath(outputPath, func(p string) bool { return h.reserved[p] })
+	if err != nil {
+		return "", nil, err
+	}
+	h.reserved[path] = true
+	return path, func() {
+		h.mu.Lock()
+		delete(h.reserved, path)
+		h.mu.Unlock()
+	}, nil
+}
+
+// freeSuffixPath returns outputPath if nothing exists there and it is not
+// taken, otherwise the first of <base>-1<ext>, <base>-2<ext>, ... that is free.
+func freeSuffixPath(outputPath string, taken func(string) bool) (string, error) {
+	free := func(p string) bool {
+		_, err := os.Lstat(p)
+		return os.IsNotExist(err) && !taken(p)
+	}
+	if free(outputPath) {
+		return outputPath, nil
+	}
+	ext := filepath.Ext(outputPath)
+	base := strings.TrimSuffix(outputPath, ext)
+	for i := 1; i < 10000; i++ {
+		if candidate := fmt.Sprintf("%s-%d%s", base, i, ext); free(candidate) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free suffix for %s", outputPath)
+}
@@ -0,0 +1,162 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	overseer "github.com/whisper-darkly/sticky-overseer/v2"
+)
+
+// recordingSubmitter collects the tasks a handler submits.
+type recordingSubmitter struct {
+	tasks []map[string]string
+}
+
+func (s *recordingSubmitter) Submit(action, taskID string, params map[string]string) error {
+	s.tasks = append(s.tasks, params)
+	return nil
+}
+
+// newTestHandler creates a converter pipeline over dir/*.ts with its database
+// in dir, applying extra on top of a minimal config.
+func newTestHandler(t *testing.T, dir string, extra map[string]any) *converterHandler {
+	t.Helper()
+	config := map[string]any{
+		"paths":   []string{filepath.Join(dir, "*.ts")},
+		"target":  map[string]any{"format": "{{.File.Dir}}/{{.File.Basename}}.mp4"},
+		"command": "true {{.Input}} {{.Output}}",
+		"db_path": filepath.Join(dir, "test.db"),
+	}
+	for k, v := range extra {
+		config[k] = v
+	}
+	ah, err := (&converterFactory{}).Create(config, "test", overseer.RetryPolicy{}, overseer.PoolConfig{}, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return ah.(*converterHandler)
+}
+
+func TestReplacedInputOverwritesOwnTargetWithSkip(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestHandler(t, dir, map[string]any{"on_conflict": "skip", "fingerprint": "stat"})
+	input := filepath.Join(dir, "a.ts")
+	target := filepath.Join(dir, "a.mp4")
+	if err := os.WriteFile(input, []byte("first version"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sub := &recordingSubmitter{}
+	h.submitPaths(sub, []string{input}, true)
+	if len(sub.tasks) != 1 {
+		t.Fatalf("first scan submitted %d tasks, want 1", len(sub.tasks))
+	}
+
+	// The first version is converted.
+	if err := os.WriteFile(target, []byte("converted first version"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.store.MarkCompleted(input); err != nil {
+		t.Fatal(err)
+	}
+
+	// The input is replaced by different content at the same path.
+	if err := os.WriteFile(input, []byte("second, longer version"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(input, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	h.submitPaths(sub, []string{input}, true)
+	if len(sub.tasks) != 2 {
+		t.Fatalf("scan after replacement submitted %d tasks in total, want 2", len(sub.tasks))
+	}
+	tf, err := h.store.GetByPath(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tf.Status != "queued" || !tf.Replacing {
+		t.Fatalf("after replacement: status %q, replacing %v; want queued and replacing", tf.Status, tf.Replacing)
+	}
+	// Start applies the same check before running the command.
+	out := h.outputs()[0]
+	if h.handleExistingTarget(input, &out, target) {
+		t.Fatalf("the previous version's output %s blocked the new version", target)
+	}
+	if tf, _ := h.store.GetByPath(input); tf.Status != "queued" {
+		t.Fatalf("status %q after the conflict check, want queued", tf.Status)
+	}
+
+	// Once completed, the policy applies again.
+	if err := h.store.MarkCompleted(input); err != nil {
+		t.Fatal(err)
+	}
+	if tf, _ := h.store.GetByPath(input); tf.Replacing {
+		t.Fatal("replacing still set after completion")
+	}
+}
+
+func TestStaleQueuedRowDoesNotHoldTarget(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestHandler(t, dir, map[string]any{
+		"target": map[string]any{"format": "{{.File.Dir}}/out.mp4"},
+	})
+	a := filepath.Join(dir, "a.ts")
+	b := filepath.Join(dir, "b.ts")
+	for _, p := range []string{a, b} {
+		if err := os.WriteFile(p, []byte(p), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a.ts sorts first, so it holds out.mp4 and b.ts waits.
+	sub := &recordingSubmitter{}
+	h.submitPaths(sub, []string{a, b}, true)
+	if len(sub.tasks) != 1 || sub.tasks[0]["file"] != a {
+		t.Fatalf("submitted %v, want only %s", sub.tasks, a)
+	}
+
+	// a.ts goes away before its task runs; its row stays queued.
+	if err := os.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	sub = &recordingSubmitter{}
+	h.submitPaths(sub, []string{b}, true)
+	if len(sub.tasks) != 1 || sub.tasks[0]["file"] != b {
+		t.Fatalf("after %s was removed, submitted %v, want %s", a, sub.tasks, b)
+	}
+	sub = &recordingSubmitter{}
+	h.submitPaths(sub, []string{b}, false)
+	if len(sub.tasks) != 1 {
+		t.Fatalf("outside a full scan, submitted %v, want %s", sub.tasks, b)
+	}
+}
+
+func TestSuffixPathsAreReserved(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestHandler(t, dir, map[string]any{"on_conflict": "suffix"})
+	target := filepath.Join(dir, "out.mp4")
+	if err := os.WriteFile(target, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	first, release, err := h.reserveSuffixPath(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := h.reserveSuffixPath(target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != filepath.Join(dir, "out-1.mp4") || second != filepath.Join(dir, "out-2.mp4") {
+		t.Fatalf("concurrent conversions got %s and %s, want out-1.mp4 and out-2.mp4", first, second)
+	}
+	release()
+	if again, _, _ := h.reserveSuffixPath(target); again != first {
+		t.Fatalf("after release got %s, want %s", again, first)
+	}
+}
@@ -0,0 +1,106 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/whisper-darkly/sticky-converter/internal/scanner"
+)
+
+// Source dispositions: what happens to an input once it converted successfully.
+const (
+	dispositionKeep       = "keep"
+	dispositionDelete     = "delete"
+	dispositionMove       = "move"
+	dispositionTrashAfter = "trash_after"
+)
+
+// disposeSource applies the configured source_disposition to a converted input.
+func (h *converterHandler) disposeSource(inputPath string) {
+	switch h.cfg.SourceDisposition {
+	case dispositionDelete:
+		if err := removeFileWithRetry(inputPath, 4, 250*time.Millisecond); err != nil {
+			log.Printf("[converter] delete input %s: %v", inputPath, err)
+		}
+	case dispositionMove:
+		dest, err := h.archivePath(inputPath)
+		if err != nil {
+			log.Printf("[converter] archive input %s: %v", inputPath, err)
+			return
+		}
+		if err := moveFile(inputPath, dest); err != nil {
+			log.Printf("[converter] archive input %s: %v", inputPath, err)
+		}
+	case dispositionTrashAfter:
+		fi, err := os.Stat(inputPath)
+		if err != nil {
+			log.Printf("[converter] schedule deletion %s: %v", inputPath, err)
+			return
+		}
+		deleteAfter := time.Now().Add(h.cfg.TrashAfter.Duration)
+		if err := h.store.ScheduleDeletion(inputPath, h.actionName, fi.ModTime(), deleteAfter); err != nil {
+			log.Printf("[converter] schedule deletion %s: %v", inputPath, err)
+		}
+	}
+}
+
+// archivePath mirrors inputPath's location below its glob base into archive_dir.
+func (h *converterHandler) archivePath(inputPath string) (string, error) {
+	_, rel, ok := scanner.RelativeTo(h.cfg.Paths, inputPath)
+	if !ok {
+		return "", fmt.Errorf("%s is outside every configured path", inputPath)
+	}
+	return filepath.Join(h.cfg.ArchiveDir, rel), nil
+}
+
+// sweepDeletions deletes trash_after sources whose retention period has ended.
+// A source whose mtime changed since it was scheduled has been replaced and is
+// kept.
+func (h *converterHandler) sweepDeletions() {
+	due, err := h.store.DueDeletions(h.actionName, time.Now())
+	if err != nil {
+		log.Printf("[converter] list due deletions: %v", err)
+		return
+	}
+	for _, pd := range due {
+		fi, err := os.Stat(pd.Path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			log.Printf("[converter] stat %s: %v", pd.Path, err)
+			continue
+		case !fi.ModTime().Equal(pd.ModTime):
+			log.Printf("[converter] %s changed since conversion; not deleting", pd.Path)
+		default:
+			if err := removeFileWithRetry(pd.Path, 4, 250*time.Millisecond); err != nil {
+				log.Printf("[converter] delete input %s: %v", pd.Path, err)
+				continue
+			}
+		}
+		if err := h.store.RemoveDeletion(pd.Path); err != nil {
+			log.Printf("[converter] forget deletion %s: %v", pd.Path, err)
+		}
+	}
+}
+
+// moveFile renames src to dst, creating dst's directory and falling back to
+// copy-and-delete across filesystems.
+func moveFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	err := os.Rename(src, dst)
+	if !errors.Is(err, syscall.EXDEV) {
+		return err
+	}
+	if err := copyFile(src, dst); err != nil {
+		os.Remove(dst)
+		return err
+	}
+	return removeFileWithRetry(src, 4, 250*time.Millisecond)
+}
@@ -0,0 +1,48 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/whisper-darkly/sticky-converter/internal/executor"
+)
+
+// extra returns the pipeline's config.extra merged with its runtime override
+// from pipeline_config. The override is read on every call, so changes made
+// through the API apply to the next task.
+func (h *converterHandler) extra() (executor.Extra, error) {
+	override, err := h.store.GetPipelineExtra(h.actionName)
+	if err != nil {
+		return nil, fmt.Errorf("read extra override: %w", err)
+	}
+	merged, err := executor.MergeExtra(h.cfg.Extra, override)
+	if err != nil {
+		return nil, err
+	}
+	return executor.ParseExtra(merged)
+}
+
+// extraOverride returns the decoded runtime override.
+func (h *converterHandler) extraOverride() (map[string]any, error) {
+	raw, err := h.store.GetPipelineExtra(h.actionName)
+	if err != nil {
+		return nil, err
+	}
+	override := map[string]any{}
+	if err := json.Unmarshal([]byte(raw), &override); err != nil {
+		return nil, fmt.Errorf("parse extra override: %w", err)
+	}
+	return override, nil
+}
+
+// setExtraOverride replaces the runtime override.
+func (h *converterHandler) setExtraOverride(override map[string]any) error {
+	if override == nil {
+		override = map[string]any{}
+	}
+	b, err := json.Marshal(override)
+	if err != nil {
+		return err
+	}
+	return h.store.SetPipelineExtra(h.actionName, string(b))
+}
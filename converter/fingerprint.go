@@ -0,0 +1,83 @@
+package converter
+
+import (
+	"errors"
+	"log"
+	"os"
+
+	"github.com/whisper-darkly/sticky-converter/internal/fingerprint"
+	"github.com/whisper-darkly/sticky-converter/internal/store"
+)
+
+// Fingerprint modes: how an input's identity is tracked beyond its path.
+const (
+	fingerprintNone = "none" // path only; completed files are never reconverted
+	fingerprintStat = "stat" // size and mtime
+	fingerprintHash = "hash" // size, mtime, and a sampled content hash
+)
+
+// sourceFingerprint returns inputPath's fingerprint, or nil if fingerprinting
+// is off or the file cannot be read.
+func (h *converterHandler) sourceFingerprint(inputPath string) *fingerprint.Fingerprint {
+	if h.cfg.Fingerprint == fingerprintNone {
+		return nil
+	}
+	fp, err := fingerprint.Of(inputPath, h.cfg.Fingerprint == fingerprintHash)
+	if err != nil {
+		log.Printf("[converter] fingerprint %s: %v", inputPath, err)
+		return nil
+	}
+	return fp
+}
+
+// sourceChanged reports whether tf's input differs from the version recorded
+// when it was converted. A changed mtime alone does not count when the sampled
+// hash still matches.
+func (h *converterHandler) sourceChanged(tf *store.TargetFile) bool {
+	if h.cfg.Fingerprint == fingerprintNone || tf.Source == nil {
+		return false
+	}
+	fi, err := os.Stat(tf.Path)
+	if err != nil {
+		return false
+	}
+	if fi.Size() != tf.Source.Size {
+		return true
+	}
+	if fi.ModTime().Equal(tf.Source.ModTime) {
+		return false
+	}
+	if h.cfg.Fingerprint != fingerprintHash || tf.Source.Hash == "" {
+		return true
+	}
+	hash, err := fingerprint.SampleHash(tf.Path, fi.Size())
+	if err != nil {
+		log.Printf("[converter] fingerprint %s: %v", tf.Path, err)
+		return false
+	}
+	return hash != tf.Source.Hash
+}
+
+// renamedFrom returns the path of a completed file that path is a rename of:
+// same size, mtime, and (with fingerprint "hash") content samples, with the
+// old path no longer present. It returns "" if there is none.
+func (h *converterHandler) renamedFrom(path string, fp *fingerprint.Fingerprint) string {
+	if fp == nil {
+		return ""
+	}
+	matches, err := h.store.ListCompletedBySource(h.actionName, fp.Size, fp.ModTime)
+	if err != nil {
+		log.Printf("[converter] look up fingerprint of %s: %v", path, err)
+		return ""
+	}
+	for _, tf := range matches {
+		if tf.Path == path || (fp.Hash != "" && tf.Source.Hash != fp.Hash) {
+			continue
+		}
+		if _, err := os.Lstat(tf.Path); !errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		return tf.Path
+	}
+	return ""
+}
@@ -7,12 +7,18 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	overseer "github.com/whisper-darkly/sticky-overseer/v2"
 	"github.com/whisper-darkly/sticky-converter/internal/db"
 	"github.com/whisper-darkly/sticky-converter/internal/executor"
+	"github.com/whisper-darkly/sticky-converter/internal/probe"
 	"github.com/whisper-darkly/sticky-converter/internal/scanner"
 	"github.com/whisper-darkly/sticky-converter/internal/store"
 )
@@ -44,30 +50,79 @@ type targetConfig struct {
 }
 
 type converterConfig struct {
-	ScanInterval    duration     `json:"scan_interval"`
-	Paths           []string     `json:"paths"`
-	Direction       string       `json:"direction"`
-	MinAge          duration     `json:"min_age,omitempty"`
-	MaxAge          duration     `json:"max_age,omitempty"`
-	Target          targetConfig `json:"target"`
-	Command         string       `json:"command"`
-	DBPath          string       `json:"db_path,omitempty"`
-	DeleteOnSuccess bool         `json:"delete_on_success"`
+	ScanInterval      duration         `json:"scan_interval"`
+	Paths             []string         `json:"paths"`
+	Direction         string           `json:"direction"`
+	MinAge            duration         `json:"min_age,omitempty"`
+	MaxAge            duration         `json:"max_age,omitempty"`
+	MinSize           int64            `json:"min_size,omitempty"`           // skip smaller files, in bytes
+	MaxSize           int64            `json:"max_size,omitempty"`           // skip larger files, in bytes
+	Fingerprint       string           `json:"fingerprint,omitempty"`        // "none" | "stat" | "hash": how replaced or renamed inputs are recognised
+	Exclude           []string         `json:"exclude,omitempty"`            // gitignore-style patterns relative to each glob base
+	ExcludeIfPresent  []string         `json:"exclude_if_present,omitempty"` // marker files that exclude their directory
+	Target            targetConfig     `json:"target"`
+	Command           string           `json:"command"`
+	Steps             []stepConfig     `json:"steps,omitempty"`   // chained commands, replacing command
+	Outputs           []outputConfig   `json:"outputs,omitempty"` // several renditions per input, replacing target and command
+	Rules             []ruleConfig     `json:"rules,omitempty"`   // commands picked by conditions on the probed input
+	Probe             bool             `json:"probe"`             // run ffprobe before each conversion and expose {{.Probe}}
+	DBPath            string           `json:"db_path,omitempty"`
+	DeleteOnSuccess   bool             `json:"delete_on_success"`            // shorthand for source_disposition: delete
+	SourceDisposition string           `json:"source_disposition,omitempty"` // "keep" | "delete" | "move" | "trash_after"
+	ArchiveDir        string           `json:"archive_dir,omitempty"`        // destination tree for "move"
+	TrashAfter        duration         `json:"trash_after,omitempty"`        // retention period for "trash_after"
+	RecoverAs         string           `json:"recover_as,omitempty"`         // "queued" | "errored" for orphaned in_flight rows
+	StaleAfter        duration         `json:"stale_after,omitempty"`        // heartbeat age before a foreign in_flight row is orphaned
+	MaxAttempts       int              `json:"max_attempts,omitempty"`       // errors before a file is marked failed (0 = unlimited)
+	RetryBackoff      duration         `json:"retry_backoff,omitempty"`      // delay before the first retry, doubled per error
+	RetryBackoffMax   duration         `json:"retry_backoff_max,omitempty"`  // upper bound on the retry delay
+	StderrTailLines   *int             `json:"stderr_tail_lines,omitempty"`  // stderr lines kept with a failure (default 20, 0 disables)
+	Progress          bool             `json:"progress"`                     // inject -progress pipe:1 and track percent/fps/speed/ETA
+	FFprobe           string           `json:"ffprobe,omitempty"`            // ffprobe binary (default "ffprobe")
+	OnConflict        string           `json:"on_conflict,omitempty"`        // "overwrite" | "skip" | "fail" | "suffix" when the target exists
+	Verify            *verifyConfig    `json:"verify,omitempty"`             // optional output checks before completion
+	Watch             bool             `json:"watch"`                        // react to inotify events between scans
+	WatchDebounce     duration         `json:"watch_debounce,omitempty"`     // quiet period before watched files are checked (default 2s)
+	Stability         *stabilityConfig `json:"stability,omitempty"`          // optional checks that a file is fully written
+	Schedule          *scheduleConfig  `json:"schedule,omitempty"`           // time windows in which work is submitted
+	Admission         *admissionConfig `json:"admission,omitempty"`          // free space, load, and memory needed to start work
+	AtomicOutput      bool             `json:"atomic_output"`                // write to a temp file, rename onto target on success
+	StagingDir        string           `json:"staging_dir,omitempty"`        // temp file location (default: target's directory)
+	Extra             map[string]any   `json:"extra,omitempty"`              // template values ({{.Extra.key}}), overridable at runtime
+	APIListen         string           `json:"api_listen,omitempty"`         // address of the runtime HTTP API (disabled when empty)
+	APIToken          string           `json:"api_token,omitempty"`          // bearer token the runtime HTTP API requires (none when empty)
 }
 
 type converterHandler struct {
 	actionName string
 	cfg        converterConfig
 	store      *store.Store
+	stability  *stabilityCheck // nil unless config.stability is set
+	rules      []rule          // compiled config.rules
+	schedule   *schedule       // nil unless config.schedule is set
+	admission  *admission      // nil unless config.admission is set
+	mu         sync.Mutex
+	forced     map[string]bool // paths to submit with force=true; see forceFile
+	reserved   map[string]bool // suffixed targets chosen by running tasks; see reserveSuffixPath
+	wake       chan string     // paths to resubmit before the next scan; see wakeUp
+	rescan     chan struct{}   // requests a full scan before the next scan_interval
+	stopping   atomic.Bool     // set once RunService's context is cancelled; see stopped
 }
 
 // Describe returns metadata about this handler for introspection.
 func (h *converterHandler) Describe() overseer.ActionInfo {
 	fileParam := &overseer.ParamSpec{} // Default=nil means required
+	params := map[string]*overseer.ParamSpec{"file": fileParam}
+	if h.multiOutput() {
+		params["output"] = &overseer.ParamSpec{}
+	}
+	for _, name := range optionalParams {
+		params[name] = optionalParam()
+	}
 	return overseer.ActionInfo{
 		Name:   h.actionName,
 		Type:   "converter",
-		Params: map[string]*overseer.ParamSpec{"file": fileParam},
+		Params: params,
 	}
 }
 
@@ -76,6 +131,12 @@ func (h *converterHandler) Validate(params map[string]string) error {
 	if params["file"] == "" {
 		return fmt.Errorf("converter: required parameter \"file\" is missing")
 	}
+	if _, err := h.output(params["output"]); err != nil {
+		return fmt.Errorf("converter: %w", err)
+	}
+	if _, err := parseTaskParams(params); err != nil {
+		return fmt.Errorf("converter: %w", err)
+	}
 	return nil
 }
 
@@ -86,12 +147,105 @@ func (h *converterHandler) Start(taskID string, params map[string]string, cb ove
 		return nil, fmt.Errorf("converter: missing required param \"file\"")
 	}
 
-	outputPath, err := executor.RenderTargetPath(inputPath, h.cfg.Target.Regex, h.cfg.Target.Format)
+	out, err := h.output(params["output"])
+	if err != nil {
+		return nil, fmt.Errorf("converter: %w", err)
+	}
+	tp, err := parseTaskParams(params)
 	if err != nil {
-		return nil, fmt.Errorf("converter: render target path: %w", err)
+		return nil, fmt.Errorf("converter: %w", err)
+	}
+	if !tp.force && h.state() == pipelineDraining {
+		return nil, fmt.Errorf("converter: pipeline %s is draining; not starting %s", h.actionName, inputPath)
+	}
+	if !tp.force && !h.schedule.open(time.Now()) {
+		return nil, fmt.Errorf("converter: pipeline %s is outside its schedule; not starting %s", h.actionName, inputPath)
+	}
+
+	outputPath := tp.target
+	if outputPath == "" {
+		if outputPath, err = h.renderTarget(inputPath, out.Target); err != nil {
+			return nil, fmt.Errorf("converter: render target path: %w", err)
+		}
+	}
+	renderedPath := outputPath
+	if err := h.prepareRow(inputPath, out, renderedPath, tp.force); err != nil {
+		return nil, fmt.Errorf("converter: %w", err)
 	}
 
-	argv, err := executor.RenderCommand(h.cfg.Command, inputPath, outputPath, "{}")
+	// In a chained pipeline only the last step writes the target; earlier
+	// ones write intermediates derived from the rendered target.
+	step, command, cmdInput := -1, out.Command, inputPath
+	if h.chained() {
+		step = h.resumeStep(inputPath, renderedPath)
+		command = h.cfg.Steps[step].Command
+		if step > 0 {
+			cmdInput = h.stepPath(renderedPath, step-1)
+		}
+	}
+	final := step == len(h.cfg.Steps)-1 || step < 0
+
+	if step <= 0 && !tp.force && h.handleExistingTarget(inputPath, out, outputPath) {
+		return nil, fmt.Errorf("converter: target %s already exists (on_conflict: %s)", outputPath, h.cfg.OnConflict)
+	}
+	unreserve, started := func() {}, false
+	defer func() {
+		if !started {
+			unreserve()
+		}
+	}()
+	if final && h.cfg.OnConflict == conflictSuffix {
+		if outputPath, unreserve, err = h.reserveSuffixPath(outputPath); err != nil {
+			return nil, fmt.Errorf("converter: %w", err)
+		}
+	}
+	_, statErr := os.Lstat(outputPath)
+	outputExisted := statErr == nil
+
+	workPath := outputPath
+	switch {
+	case !final:
+		workPath = h.stepPath(renderedPath, step)
+	case h.cfg.AtomicOutput:
+		workPath = stagingPath(outputPath, h.cfg.StagingDir)
+	}
+	if workPath != outputPath {
+		if err := os.MkdirAll(filepath.Dir(workPath), 0755); err != nil {
+			return nil, fmt.Errorf("converter: create staging dir: %w", err)
+		}
+	}
+
+	extra, err := h.extra()
+	if err != nil {
+		return nil, fmt.Errorf("converter: %w", err)
+	}
+	extra = tp.withExtra(extra)
+	fv := h.fileVars(inputPath)
+
+	var media *probe.Result
+	var mediaVars map[string]any
+	if h.probes() {
+		if media, err = h.probeInput(inputPath); err != nil {
+			return nil, h.failStart(inputPath, fmt.Sprintf("probe: %v", err))
+		}
+		mediaVars = media.Vars()
+		if len(h.rules) > 0 {
+			if command, err = h.pickCommand(inputPath, ruleVars(mediaVars, fv, extra), command); err != nil {
+				return nil, h.failStart(inputPath, err.Error())
+			}
+		}
+	}
+
+	argv, err := executor.RenderCommandData(command, executor.TemplateData{
+		Input:    cmdInput,
+		Output:   workPath,
+		Extra:    extra,
+		File:     fv,
+		Source:   inputPath,
+		Pipeline: h.actionName,
+		Probe:    mediaVars,
+		Task:     tp.vars(),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("converter: render command: %w", err)
 	}
@@ -99,33 +253,142 @@ func (h *converterHandler) Start(taskID string, params map[string]string, cb ove
 		return nil, fmt.Errorf("converter: command rendered to empty argv")
 	}
 
-	if err := h.store.MarkInFlight(inputPath); err != nil {
+	var progress *progressTracker
+	if h.cfg.Progress {
+		var ok bool
+		if argv, ok = withProgressArgs(argv); ok {
+			var duration time.Duration
+			if media != nil {
+				duration = time.Duration(media.Duration * float64(time.Second))
+			} else {
+				duration = h.probeDuration(inputPath)
+			}
+			progress = newProgressTracker(duration)
+		}
+	}
+	argv = tp.withPriority(argv)
+
+	reason, release := h.admission.start(inputPath, workPath, h.outputDirs(outputPath))
+	if reason != "" {
+		h.hold(inputPath, reason)
+		if tp.force {
+			h.keepForced(inputPath)
+		}
+		return nil, fmt.Errorf("converter: not starting %s: %s", inputPath, reason)
+	}
+
+	if src := h.sourceFingerprint(inputPath); src != nil {
+		if err := h.store.SetSource(inputPath, src); err != nil {
+			log.Printf("[converter] record fingerprint %s: %v", inputPath, err)
+		}
+	}
+	if err := h.store.MarkInFlight(inputPath, bootID); err != nil {
 		log.Printf("[converter] mark in_flight %s: %v", inputPath, err)
 	}
+	if h.multiOutput() {
+		if err := h.store.MarkOutputInFlight(inputPath, out.Name, outputPath); err != nil {
+			log.Printf("[converter] mark output %s in_flight %s: %v", out.Name, inputPath, err)
+		}
+	}
+	attemptOutput := outputPath
+	if !final {
+		attemptOutput = workPath
+	}
+	attempt, err := h.store.StartAttempt(inputPath, taskID, step, argv, attemptOutput)
+	if err != nil {
+		log.Printf("[converter] record attempt %s: %v", inputPath, err)
+	}
 
-	deleteOnSuccess := h.cfg.DeleteOnSuccess
 	st := h.store
+	stderrTail := newLineTail(*h.cfg.StderrTailLines)
 
 	wrappedCB := overseer.NewWorkerCallbacks(
-		cb.OnOutput,
+		func(w *overseer.Worker, stream string, data []byte, t time.Time) {
+			if stream == "stderr" {
+				stderrTail.Add(string(data))
+			}
+			if progress != nil && stream == "stdout" {
+				if snap, ok := progress.Feed(string(data)); ok {
+					if err := st.UpdateProgress(inputPath, snap); err != nil {
+						log.Printf("[converter] update progress %s: %v", inputPath, err)
+					}
+					if cb.LogEvent != nil {
+						cb.LogEvent(w, formatProgress(snap), t)
+					}
+				}
+				return
+			}
+			if cb.OnOutput != nil {
+				cb.OnOutput(w, stream, data, t)
+			}
+		},
 		cb.LogEvent,
 		func(w *overseer.Worker, exitCode int, intentional bool, t time.Time) {
-			if exitCode == 0 {
+			outputSize := int64(-1)
+			if fi, err := os.Stat(workPath); err == nil {
+				outputSize = fi.Size()
+			}
+
+			var errMsg string
+			if intentional {
+				errMsg = "stopped"
+			} else if exitCode != 0 {
+				errMsg = fmt.Sprintf("exit code %d", exitCode)
+				if tail := stderrTail.String(); tail != "" {
+					errMsg += "\n" + tail
+				}
+			} else if final && out.Verify != nil {
+				if err := h.verifyOutput(out.Verify, inputPath, workPath); err != nil {
+					errMsg = fmt.Sprintf("verify: %v", err)
+				}
+			}
+			if errMsg == "" && final && workPath != outputPath {
+				if err := commitStaged(workPath, outputPath); err != nil {
+					errMsg = fmt.Sprintf("commit output: %v", err)
+				}
+			}
+
+			if errMsg != "" && (workPath != outputPath || !outputExisted) {
+				if err := removeFileWithRetry(workPath, 4, 250*time.Millisecond); err != nil {
+					log.Printf("[converter] remove staged output %s: %v", workPath, err)
+				}
+			}
+			switch {
+			case intentional:
+				h.stopped(inputPath, out)
+			case h.multiOutput():
+				h.finishOutput(inputPath, out, errMsg)
+			case errMsg == "" && !final:
+				h.advanceStep(inputPath, renderedPath, step)
+			case errMsg == "":
 				if err := st.MarkCompleted(inputPath); err != nil {
 					log.Printf("[converter] mark completed %s: %v", inputPath, err)
 				}
-				if deleteOnSuccess {
-					if err := removeFileWithRetry(inputPath, 4, 250*time.Millisecond); err != nil {
-						log.Printf("[converter] delete input %s: %v", inputPath, err)
-					}
+				h.removeIntermediates(inputPath)
+				h.disposeSource(inputPath)
+			default:
+				rowMsg := errMsg
+				if step >= 0 {
+					rowMsg = h.stepLabel(step) + ": " + errMsg
 				}
-			} else {
-				errMsg := fmt.Sprintf("exit code %d", exitCode)
-				if err := st.MarkErrored(inputPath, errMsg); err != nil {
+				if err := st.MarkErrored(inputPath, rowMsg); err != nil {
 					log.Printf("[converter] mark errored %s: %v", inputPath, err)
 				}
+				h.failIfExhausted(inputPath)
 			}
+
+			if attempt > 0 {
+				if err := st.FinishAttempt(inputPath, attempt, exitCode, intentional, outputSize, stderrTail.String(), errMsg); err != nil {
+					log.Printf("[converter] finish attempt %s #%d: %v", inputPath, attempt, err)
+				}
+			}
+			release()
+			unreserve()
 			cb.OnExited(w, exitCode, intentional, t)
+			h.finishDrain()
+			if h.chained() || h.multiOutput() {
+				h.wakeUp(inputPath)
+			}
 		},
 	)
 
@@ -136,7 +399,27 @@ func (h *converterHandler) Start(taskID string, params map[string]string, cb ove
 		IncludeStdout: true,
 		IncludeStderr: true,
 	}
-	return overseer.StartWorker(workerCfg, wrappedCB)
+	w, err := overseer.StartWorker(workerCfg, wrappedCB)
+	started = err == nil
+	if err != nil {
+		release()
+		errMsg := fmt.Sprintf("start worker: %v", err)
+		if attempt > 0 {
+			if err := st.FinishAttempt(inputPath, attempt, -1, false, -1, "", errMsg); err != nil {
+				log.Printf("[converter] finish attempt %s #%d: %v", inputPath, attempt, err)
+			}
+		}
+		if h.multiOutput() {
+			h.finishOutput(inputPath, out, errMsg)
+		} else if step >= 0 {
+			if err := st.MarkErrored(inputPath, h.stepLabel(step)+": "+errMsg); err != nil {
+				log.Printf("[converter] mark errored %s: %v", inputPath, err)
+			}
+		} else if err := st.MarkErrored(inputPath, errMsg); err != nil {
+			log.Printf("[converter] mark errored %s: %v", inputPath, err)
+		}
+	}
+	return w, err
 }
 
 // RunService implements overseer.ServiceHandler — the directory scan loop.
@@ -147,41 +430,300 @@ func (h *converterHandler) RunService(ctx context.Context, submit overseer.TaskS
 		scanInterval = 30 * time.Second
 	}
 
+	// Workers stopped from here on are stopped by the shutdown, not an
+	// operator.
+	stopWatching := context.AfterFunc(ctx, func() { h.stopping.Store(true) })
+	defer stopWatching()
+
+	w := h.startWatcher()
+	if w != nil {
+		defer w.Close()
+	}
+	if h.cfg.APIListen != "" {
+		if err := registerAPI(h.cfg.APIListen, h.cfg.APIToken, h); err != nil {
+			log.Printf("[converter] api on %s unavailable: %v", h.cfg.APIListen, err)
+		} else {
+			defer unregisterAPI(h.cfg.APIListen, h)
+		}
+	}
+
+	go h.heartbeat(ctx, heartbeatInterval(scanInterval, h.cfg.StaleAfter.Duration))
+
 	// Initial scan immediately.
+	h.sweepDeletions()
 	h.scan(submit)
 
 	ticker := time.NewTicker(scanInterval)
 	defer ticker.Stop()
 
+	// Scan as soon as a schedule window opens rather than at the next tick.
+	opening := time.NewTimer(time.Hour)
+	opening.Stop()
+	defer opening.Stop()
+	armOpening := func() {
+		if at, ok := h.schedule.nextOpen(time.Now()); ok {
+			opening.Reset(time.Until(at))
+		}
+	}
+	armOpening()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case path, ok := <-w.Events():
+			if !ok {
+				log.Printf("[converter] filesystem watch stopped; relying on scan_interval")
+				w = nil
+				continue
+			}
+			w.add(path)
+		case path := <-h.wake:
+			if tf, err := h.store.GetByPath(path); err == nil && tf.Status == "queued" {
+				h.submitPaths(submit, []string{path}, false)
+			}
+		case <-w.Overflow():
+			log.Printf("[converter] filesystem events lost; rescanning")
+			h.scan(submit)
+		case <-w.Due():
+			// Files that are not yet stable are left to the next scan.
+			h.submitPaths(submit, w.ready(h.cfg.Paths, h.scanOptions()), false)
 		case <-ticker.C:
+			if h.cfg.StaleAfter.Duration > 0 {
+				h.recoverOrphaned()
+			}
+			h.sweepDeletions()
+			h.finishDrain()
+			h.scan(submit)
+			armOpening()
+		case <-opening.C:
+			log.Printf("[converter] pipeline %s: schedule window open", h.actionName)
+			h.scan(submit)
+		case <-h.rescan:
 			h.scan(submit)
 		}
 	}
 }
 
 func (h *converterHandler) scan(submit overseer.TaskSubmitter) {
-	paths, err := scanner.ScanAll(h.cfg.Paths, h.cfg.Direction, h.cfg.MinAge.Duration, h.cfg.MaxAge.Duration)
+	paths, err := scanner.ScanAll(h.cfg.Paths, h.scanOptions())
 	if err != nil {
 		log.Printf("[converter] scan error: %v", err)
 		return
 	}
+	start := time.Now()
+	h.submitPaths(submit, paths, true)
+	h.stability.prune(start)
+}
+
+// scanOptions returns the scanner filters configured for this pipeline, plus
+// hiddenExcludes.
+func (h *converterHandler) scanOptions() scanner.Options {
+	return scanner.Options{
+		Direction:        h.cfg.Direction,
+		MinAge:           h.cfg.MinAge.Duration,
+		MaxAge:           h.cfg.MaxAge.Duration,
+		MinSize:          h.cfg.MinSize,
+		MaxSize:          h.cfg.MaxSize,
+		Exclude:          append(slices.Clone(h.cfg.Exclude), hiddenExcludes...),
+		ExcludeIfPresent: h.cfg.ExcludeIfPresent,
+	}
+}
 
+// submitPaths queues and submits every path that still needs converting,
+// unless the pipeline is paused, draining, or outside its schedule. Files
+// that admission control holds back stay queued with a hold reason. fullScan
+// reports whether paths come from a full scan, which counts toward the
+// stability checks.
+func (h *converterHandler) submitPaths(submit overseer.TaskSubmitter, paths []string, fullScan bool) {
+	if h.state() != pipelineRunning || !h.schedule.open(time.Now()) {
+		return
+	}
+	now := time.Now()
+	h.stability.beginBatch(fullScan)
+	batch := h.admission.batch()
+	var scanned map[string]bool
+	if fullScan {
+		scanned = make(map[string]bool, len(paths))
+		for _, path := range paths {
+			scanned[path] = true
+		}
+	}
 	for _, path := range paths {
-		if h.store.IsCompleted(path) || h.store.IsInFlight(path) {
+		tf, err := h.store.GetByPath(path)
+		if err == nil {
+			switch tf.Status {
+			case "completed", "failed":
+				if !h.sourceChanged(tf) {
+					continue
+				}
+				log.Printf("[converter] %s changed since it was %s; converting the new version", path, tf.Status)
+				h.removeIntermediates(path)
+				if err := h.store.RequeueNewVersion(path); err != nil {
+					log.Printf("[converter] requeue %s: %v", path, err)
+					continue
+				}
+				tf.StartedAt = nil
+			case "in_flight", "paused":
+				continue
+			case "errored":
+				if h.failIfExhausted(path) || !h.retryDue(tf, now) {
+					continue
+				}
+			}
+		}
+		// Stability only gates the first run; a file that has been started
+		// before (a retry, the next step or output) is already settled.
+		if (tf == nil || tf.StartedAt == nil) && !h.stability.settled(path, now) {
 			continue
 		}
-		if err := h.store.UpsertQueued(path, h.actionName); err != nil {
+		targets, err := h.renderTargets(path)
+		if err != nil {
+			log.Printf("[converter] render target path %s: %v", path, err)
+			continue
+		}
+		src := h.sourceFingerprint(path)
+		if err := h.store.UpsertQueued(path, h.actionName, targets[0], src); err != nil {
 			log.Printf("[converter] upsert queued %s: %v", path, err)
 			continue
 		}
-		if err := submit.Submit(h.actionName, "", map[string]string{"file": path}); err != nil {
+		if tf == nil {
+			if old := h.renamedFrom(path, src); old != "" {
+				log.Printf("[converter] %s is %s renamed, which is already converted; marking completed", path, old)
+				if err := h.store.MarkCompleted(path); err != nil {
+					log.Printf("[converter] mark completed %s: %v", path, err)
+				}
+				continue
+			}
+		}
+		h.submitOutputs(submit, batch, scanned, path, targets)
+	}
+}
+
+// submitOutputs submits a task for every output of path that has not
+// completed and is not running. targets holds the rendered target of each
+// output in h.outputs() order. Outputs that batch does not admit are held.
+// scanned holds the paths of a full scan, or is nil; see claimedBy.
+func (h *converterHandler) submitOutputs(submit overseer.TaskSubmitter, batch *admissionBatch, scanned map[string]bool, path string, targets []string) {
+	var rows map[string]*store.TargetOutput
+	if h.multiOutput() {
+		list, err := h.store.ListOutputs(path)
+		if err != nil {
+			log.Printf("[converter] list outputs %s: %v", path, err)
+			return
+		}
+		rows = make(map[string]*store.TargetOutput, len(list))
+		for _, o := range list {
+			rows[o.Name] = o
+		}
+	}
+
+	// A chain past its first step has already checked the target.
+	resuming := false
+	if h.chained() {
+		if tf, err := h.store.GetByPath(path); err == nil && tf.Step > 0 {
+			resuming = true
+		}
+	}
+
+	force := h.isForced(path)
+	failed := 0
+	held := 0
+	pending := 0
+	outputs := h.outputs()
+	for i := range outputs {
+		out, target := &outputs[i], targets[i]
+		params := map[string]string{"file": path}
+		if h.multiOutput() {
+			if o := rows[out.Name]; o != nil && (o.Status == "completed" || o.Status == "in_flight") {
+				continue
+			}
+			if err := h.store.EnsureOutput(path, out.Name, target); err != nil {
+				log.Printf("[converter] record output %s of %s: %v", out.Name, path, err)
+				continue
+			}
+			params["output"] = out.Name
+		}
+		if force {
+			params["force"] = "true"
+		}
+		pending++
+
+		if other, err := h.claimedBy(target, path, scanned); err != nil {
+			log.Printf("[converter] check target %s: %v", target, err)
+			continue
+		} else if other != "" {
+			log.Printf("[converter] %s and %s both render to %s; holding %s", other, path, target, path)
+			continue
+		}
+		if !resuming && !force && h.handleExistingTarget(path, out, target) {
+			continue
+		}
+		if reason, _ := batch.admit(path, h.outputDirs(target)); reason != "" {
+			log.Printf("[converter] holding %s: %s", path, reason)
+			h.hold(path, reason)
+			held++
+			continue
+		}
+		if err := submit.Submit(h.actionName, "", params); err != nil {
 			log.Printf("[converter] submit %s: %v", path, err)
+			failed++
 		}
 	}
+	if force && failed == 0 && held == 0 {
+		h.unforce(path)
+	}
+	if h.multiOutput() && pending == 0 {
+		h.settleOutputs(path, false)
+	}
+}
+
+// failStart records an error found before the worker was started, so the
+// file backs off and counts toward max_attempts like a failed run, and
+// returns it for Start.
+func (h *converterHandler) failStart(path, errMsg string) error {
+	if err := h.store.MarkErrored(path, errMsg); err != nil {
+		log.Printf("[converter] mark errored %s: %v", path, err)
+	}
+	h.failIfExhausted(path)
+	return fmt.Errorf("converter: %s: %s", path, errMsg)
+}
+
+// failIfExhausted marks path failed once its error_count reaches max_attempts
+// and reports whether it did.
+func (h *converterHandler) failIfExhausted(path string) bool {
+	if h.cfg.MaxAttempts <= 0 {
+		return false
+	}
+	tf, err := h.store.GetByPath(path)
+	if err != nil || tf.ErrorCount < h.cfg.MaxAttempts {
+		return false
+	}
+	if err := h.store.MarkFailed(path); err != nil {
+		log.Printf("[converter] mark failed %s: %v", path, err)
+		return false
+	}
+	log.Printf("[converter] %s failed after %d attempts", path, tf.ErrorCount)
+	h.removeIntermediates(path)
+	return true
+}
+
+// retryDue reports whether an errored file's backoff has elapsed. The delay is
+// retry_backoff doubled for every error after the first, capped at
+// retry_backoff_max.
+func (h *converterHandler) retryDue(tf *store.TargetFile, now time.Time) bool {
+	base := h.cfg.RetryBackoff.Duration
+	if base <= 0 || tf.LastAttemptedAt == nil {
+		return true
+	}
+	delay := base
+	for i := 1; i < tf.ErrorCount && delay < h.cfg.RetryBackoffMax.Duration; i++ {
+		delay *= 2
+	}
+	if delay > h.cfg.RetryBackoffMax.Duration {
+		delay = h.cfg.RetryBackoffMax.Duration
+	}
+	return !now.Before(tf.LastAttemptedAt.Add(delay))
 }
 
 // ---------------------------------------------------------------------------
@@ -207,15 +749,144 @@ func (f *converterFactory) Create(config map[string]any, actionName string, merg
 	if len(cfg.Paths) == 0 {
 		return nil, fmt.Errorf("converter: config.paths is required")
 	}
-	if cfg.Target.Format == "" {
-		return nil, fmt.Errorf("converter: config.target.format is required")
+	if len(cfg.Outputs) == 0 {
+		if cfg.Target.Format == "" {
+			return nil, fmt.Errorf("converter: config.target.format is required")
+		}
+		if cfg.Command == "" && len(cfg.Steps) == 0 && len(cfg.Rules) == 0 {
+			return nil, fmt.Errorf("converter: config.command is required")
+		}
+	}
+	if len(cfg.Rules) > 0 && (len(cfg.Steps) > 0 || len(cfg.Outputs) > 0) {
+		return nil, fmt.Errorf("converter: config.rules cannot be combined with config.steps or config.outputs")
+	}
+	rules, err := compileRules(cfg.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("converter: config.%w", err)
+	}
+	sched, err := parseSchedule(cfg.Schedule)
+	if err != nil {
+		return nil, fmt.Errorf("converter: config.schedule.%w", err)
+	}
+	if len(cfg.Steps) > 0 {
+		if len(cfg.Outputs) > 0 {
+			return nil, fmt.Errorf("converter: config.steps and config.outputs cannot be combined")
+		}
+		if cfg.Command != "" {
+			return nil, fmt.Errorf("converter: config.steps replaces config.command; set only one")
+		}
+		for i, step := range cfg.Steps {
+			if step.Command == "" {
+				return nil, fmt.Errorf("converter: config.steps[%d].command is required", i)
+			}
+			if step.Ext != "" && !strings.HasPrefix(step.Ext, ".") {
+				return nil, fmt.Errorf("converter: config.steps[%d].ext must start with \".\"", i)
+			}
+		}
+	}
+	names := make(map[string]bool, len(cfg.Outputs))
+	required := 0
+	for i := range cfg.Outputs {
+		out := &cfg.Outputs[i]
+		if out.Name == "" {
+			return nil, fmt.Errorf("converter: config.outputs[%d].name is required", i)
+		}
+		if names[out.Name] {
+			return nil, fmt.Errorf("converter: duplicate config.outputs name %q", out.Name)
+		}
+		names[out.Name] = true
+		if out.Target.Format == "" {
+			return nil, fmt.Errorf("converter: config.outputs[%s].target.format is required", out.Name)
+		}
+		if out.Command == "" {
+			return nil, fmt.Errorf("converter: config.outputs[%s].command is required", out.Name)
+		}
+		if out.Verify == nil {
+			out.Verify = cfg.Verify
+		}
+		if !out.Optional {
+			required++
+		}
 	}
-	if cfg.Command == "" {
-		return nil, fmt.Errorf("converter: config.command is required")
+	if len(cfg.Outputs) > 0 && required == 0 {
+		return nil, fmt.Errorf("converter: config.outputs needs at least one output that is not optional")
 	}
 	if cfg.Direction == "" {
 		cfg.Direction = "oldest"
 	}
+	if !slices.Contains(scanner.Directions, cfg.Direction) {
+		return nil, fmt.Errorf("converter: config.direction must be one of %s, got %q", strings.Join(scanner.Directions, ", "), cfg.Direction)
+	}
+	if cfg.MinSize < 0 || cfg.MaxSize < 0 {
+		return nil, fmt.Errorf("converter: config.min_size and config.max_size must not be negative")
+	}
+	if cfg.MaxSize > 0 && cfg.MinSize > cfg.MaxSize {
+		return nil, fmt.Errorf("converter: config.min_size must not exceed config.max_size")
+	}
+	switch cfg.SourceDisposition {
+	case "":
+		cfg.SourceDisposition = dispositionKeep
+		if cfg.DeleteOnSuccess {
+			cfg.SourceDisposition = dispositionDelete
+		}
+	case dispositionKeep, dispositionDelete:
+	case dispositionMove:
+		if cfg.ArchiveDir == "" {
+			return nil, fmt.Errorf("converter: config.archive_dir is required for source_disposition \"move\"")
+		}
+	case dispositionTrashAfter:
+		if cfg.TrashAfter.Duration <= 0 {
+			return nil, fmt.Errorf("converter: config.trash_after is required for source_disposition \"trash_after\"")
+		}
+	default:
+		return nil, fmt.Errorf("converter: unknown config.source_disposition %q", cfg.SourceDisposition)
+	}
+	switch cfg.Fingerprint {
+	case "":
+		cfg.Fingerprint = fingerprintNone
+	case fingerprintNone, fingerprintStat, fingerprintHash:
+	default:
+		return nil, fmt.Errorf("converter: unknown config.fingerprint %q", cfg.Fingerprint)
+	}
+	switch cfg.OnConflict {
+	case "":
+		cfg.OnConflict = conflictOverwrite
+	case conflictOverwrite, conflictSkip, conflictFail, conflictSuffix:
+	default:
+		return nil, fmt.Errorf("converter: unknown config.on_conflict %q", cfg.OnConflict)
+	}
+	if cfg.StaleAfter.Duration < 0 || (cfg.StaleAfter.Duration > 0 && cfg.StaleAfter.Duration < 10*time.Second) {
+		return nil, fmt.Errorf("converter: config.stale_after must be at least 10s")
+	}
+	if cfg.MaxAttempts < 0 {
+		return nil, fmt.Errorf("converter: config.max_attempts must not be negative")
+	}
+	if cfg.StderrTailLines == nil {
+		n := 20
+		cfg.StderrTailLines = &n
+	}
+	if cfg.Stability != nil && cfg.Stability.Scans < 0 {
+		return nil, fmt.Errorf("converter: config.stability.scans must not be negative")
+	}
+	if a := cfg.Admission; a != nil && (a.MinFree < 0 || a.SizeRatio < 0 || a.MaxLoad < 0 || a.MinMemAvailable < 0) {
+		return nil, fmt.Errorf("converter: config.admission values must not be negative")
+	}
+	if cfg.WatchDebounce.Duration <= 0 {
+		cfg.WatchDebounce.Duration = 2 * time.Second
+	}
+	if cfg.RetryBackoffMax.Duration <= 0 {
+		cfg.RetryBackoffMax.Duration = 24 * time.Hour
+	}
+	switch cfg.RecoverAs {
+	case "":
+		cfg.RecoverAs = "queued"
+	case "queued", "errored":
+	default:
+		return nil, fmt.Errorf("converter: config.recover_as must be \"queued\" or \"errored\", got %q", cfg.RecoverAs)
+	}
+	if cfg.APIListen != "" && cfg.APIToken == "" && !loopbackAddr(cfg.APIListen) {
+		return nil, fmt.Errorf("converter: config.api_listen %q is not a loopback address; set config.api_token to serve the API on it", cfg.APIListen)
+	}
 
 	dbPath := cfg.DBPath
 	if dbPath == "" {
@@ -233,11 +904,25 @@ func (f *converterFactory) Create(config map[string]any, actionName string, merg
 		return nil, fmt.Errorf("converter: init store: %w", err)
 	}
 
-	return &converterHandler{
+	h := &converterHandler{
 		actionName: actionName,
 		cfg:        cfg,
 		store:      st,
-	}, nil
+		rules:      rules,
+		schedule:   sched,
+		forced:     make(map[string]bool),
+		reserved:   make(map[string]bool),
+		wake:       make(chan string, 64),
+		rescan:     make(chan struct{}, 1),
+	}
+	if cfg.Stability != nil {
+		h.stability = newStabilityCheck(cfg.Stability, h.renderTarget)
+	}
+	if cfg.Admission != nil {
+		h.admission = newAdmission(cfg.Admission)
+	}
+	h.recoverOrphaned()
+	return h, nil
 }
 
 func init() {
@@ -0,0 +1,167 @@
+package converter
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// openAPIComponents holds the parameters, responses, and schemas referenced by
+// the docs in apiRoutes.
+const openAPIComponents = `{
+  "parameters": {
+    "name": {"name": "name", "in": "path", "required": true, "description": "Pipeline (action) name", "schema": {"type": "string"}}
+  },
+  "responses": {
+    "error": {"description": "Error", "content": {"application/json": {"schema": {
+      "type": "object", "properties": {"error": {"type": "string"}}}}}},
+    "extra": {"description": "Extra values", "content": {"application/json": {"schema": {
+      "type": "object", "properties": {
+        "config": {"type": "object", "description": "config.extra from YAML"},
+        "override": {"type": "object", "description": "Runtime override from pipeline_config"},
+        "merged": {"type": "object", "description": "What templates see as {{.Extra}}"}}}}}},
+    "state": {"description": "Pipeline state", "content": {"application/json": {"schema": {
+      "type": "object", "properties": {
+        "pipeline": {"type": "string"},
+        "state": {"$ref": "#/components/schemas/PipelineState"},
+        "in_schedule": {"type": "boolean", "description": "Inside a schedule window, or no schedule is set"},
+        "in_flight": {"type": "integer"}}}}}}
+  },
+  "schemas": {
+    "PipelineState": {
+      "type": "string",
+      "enum": ["running", "paused", "draining"],
+      "description": "paused submits nothing new; draining also refuses tasks already submitted and becomes paused once nothing is in_flight"
+    },
+    "File": {
+      "type": "object",
+      "properties": {
+        "path": {"type": "string"},
+        "pipeline": {"type": "string"},
+        "status": {"type": "string", "enum": ["queued", "in_flight", "completed", "errored", "failed", "paused"]},
+        "error_count": {"type": "integer"},
+        "error_message": {"type": "string"},
+        "target_path": {"type": "string"},
+        "step": {"type": "integer", "description": "Next step of a chained pipeline"},
+        "hold_reason": {"type": "string", "description": "Why a queued file is held back by admission control, e.g. \"waiting for disk\""},
+        "queued_at": {"type": "string", "format": "date-time"},
+        "started_at": {"type": "string", "format": "date-time"},
+        "completed_at": {"type": "string", "format": "date-time"},
+        "last_attempted_at": {"type": "string", "format": "date-time"},
+        "progress": {
+          "type": "object",
+          "properties": {
+            "percent": {"type": "number"},
+            "out_time_ms": {"type": "integer"},
+            "fps": {"type": "number"},
+            "speed": {"type": "number"},
+            "eta_ms": {"type": "integer"},
+            "updated_at": {"type": "string", "format": "date-time"}
+          }
+        }
+      }
+    },
+    "FileList": {
+      "type": "object",
+      "properties": {
+        "files": {"type": "array", "items": {"$ref": "#/components/schemas/File"}},
+        "total": {"type": "integer", "description": "Matching files before paging"},
+        "limit": {"type": "integer"},
+        "offset": {"type": "integer"}
+      }
+    },
+    "FileSelector": {
+      "type": "object",
+      "description": "Files to operate on: paths, or every file matching glob and status",
+      "properties": {
+        "paths": {"type": "array", "items": {"type": "string"}},
+        "glob": {"type": "string", "description": "Doublestar pattern matched against the input path"},
+        "status": {"type": "string"}
+      }
+    },
+    "FileOpResult": {
+      "type": "object",
+      "properties": {
+        "applied": {"type": "array", "items": {"type": "string"}},
+        "skipped": {"type": "array", "items": {"type": "object", "properties": {
+          "path": {"type": "string"}, "reason": {"type": "string"}}}}
+      }
+    },
+    "Stats": {
+      "type": "object",
+      "properties": {
+        "pipeline": {"type": "string"},
+        "state": {"$ref": "#/components/schemas/PipelineState"},
+        "total": {"type": "integer"},
+        "queued": {"type": "integer"},
+        "in_flight": {"type": "integer"},
+        "completed": {"type": "integer"},
+        "errored": {"type": "integer"},
+        "failed": {"type": "integer"},
+        "paused": {"type": "integer"}
+      }
+    }
+  }
+}`
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// openAPIDocument builds the OpenAPI document for apiRoutes. Path parameters
+// are taken from the route patterns, and the op parameter lists fileOps.
+// With auth, every operation requires the bearer token.
+func openAPIDocument(auth bool) ([]byte, error) {
+	var components map[string]map[string]any
+	if err := json.Unmarshal([]byte(openAPIComponents), &components); err != nil {
+		return nil, err
+	}
+	ops := make([]string, 0, len(fileOps))
+	for name := range fileOps {
+		ops = append(ops, name)
+	}
+	sort.Strings(ops)
+	components["parameters"]["op"] = map[string]any{
+		"name": "op", "in": "path", "required": true,
+		"schema": map[string]any{"type": "string", "enum": ops},
+	}
+
+	paths := map[string]map[string]any{}
+	for _, route := range apiRoutes {
+		item := paths[route.path]
+		if item == nil {
+			item = map[string]any{}
+			var params []any
+			for _, m := range pathParam.FindAllStringSubmatch(route.path, -1) {
+				params = append(params, map[string]string{"$ref": "#/components/parameters/" + m[1]})
+			}
+			if params != nil {
+				item["parameters"] = params
+			}
+			paths[route.path] = item
+		}
+		item[strings.ToLower(route.method)] = json.RawMessage(route.doc)
+	}
+
+	doc := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":       "sticky-converter API",
+			"description": "Runtime control and status of converter pipelines, served on api_listen.",
+			"version":     "1",
+		},
+		"paths":      paths,
+		"components": components,
+	}
+	if auth {
+		components["securitySchemes"] = map[string]any{"token": map[string]string{"type": "http", "scheme": "bearer"}}
+		doc["security"] = []any{map[string][]string{"token": {}}}
+	}
+	return json.MarshalIndent(doc, "", "  ")
+}
+
+// openAPI serves GET /openapi.json.
+func (s *apiServer) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.doc)
+}
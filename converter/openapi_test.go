@@ -0,0 +1,72 @@
+package converter
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPIDocumentCoversRoutes(t *testing.T) {
+	for _, auth := range []bool{false, true} {
+		raw, err := openAPIDocument(auth)
+		if err != nil {
+			t.Fatalf("openAPIDocument(%v): %v", auth, err)
+		}
+		var doc struct {
+			Paths    map[string]map[string]json.RawMessage `json:"paths"`
+			Security []map[string][]string                 `json:"security"`
+		}
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			t.Fatalf("openAPIDocument(%v) is not JSON: %v", auth, err)
+		}
+		for _, route := range apiRoutes {
+			if _, ok := doc.Paths[route.path][strings.ToLower(route.method)]; !ok {
+				t.Errorf("%s %s is served but not documented", route.method, route.path)
+			}
+		}
+		var all map[string]any
+		json.Unmarshal(raw, &all)
+		for _, ref := range refs(all) {
+			if !resolves(all, ref) {
+				t.Errorf("unresolved $ref %s", ref)
+			}
+		}
+		if auth != (len(doc.Security) > 0) {
+			t.Errorf("openAPIDocument(%v): security %v", auth, doc.Security)
+		}
+	}
+}
+
+// refs returns every $ref in v.
+func refs(v any) []string {
+	var out []string
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if ref, ok := e.(string); ok && k == "$ref" {
+				out = append(out, ref)
+			}
+			out = append(out, refs(e)...)
+		}
+	case []any:
+		for _, e := range v {
+			out = append(out, refs(e)...)
+		}
+	}
+	return out
+}
+
+// resolves reports whether the local reference ref points into doc.
+func resolves(doc map[string]any, ref string) bool {
+	var cur any = doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return false
+		}
+		if cur, ok = m[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
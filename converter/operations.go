@@ -0,0 +1,184 @@
+package converter
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/whisper-darkly/sticky-converter/internal/store"
+)
+
+// fileOps are the operator commands that can be applied to files, by name.
+// Each returns an error explaining why a file was left alone.
+var fileOps = map[string]func(h *converterHandler, tf *store.TargetFile) error{
+	"pause":   (*converterHandler).pauseFile,
+	"resume":  (*converterHandler).resumeFile,
+	"retry":   (*converterHandler).retryFile,
+	"requeue": (*converterHandler).requeueFile,
+	"force":   (*converterHandler).forceFile,
+}
+
+var errStatusChanged = errors.New("status changed; try again")
+
+// pauseFile holds a queued or errored file until it is resumed. A running
+// file is paused by stopping its task.
+func (h *converterHandler) pauseFile(tf *store.TargetFile) error {
+	if tf.Status == "in_flight" {
+		return errors.New("in_flight; stop its task to pause it")
+	}
+	if tf.Status != "queued" && tf.Status != "errored" {
+		return fmt.Errorf("cannot pause a %s file", tf.Status)
+	}
+	return h.applied(h.store.PauseWaiting(tf.Path))
+}
+
+// resumeFile queues a paused file again. A chain resumes at its current step
+// and a multi-output file keeps its finished outputs.
+func (h *converterHandler) resumeFile(tf *store.TargetFile) error {
+	if tf.Status != "paused" {
+		return fmt.Errorf("not paused (%s)", tf.Status)
+	}
+	if err := h.applied(h.store.MarkResumed(tf.Path)); err != nil {
+		return err
+	}
+	h.wakeUp(tf.Path)
+	return nil
+}
+
+// retryFile queues an errored or failed file right away, ignoring its
+// backoff. The error count is kept, so max_attempts still applies.
+func (h *converterHandler) retryFile(tf *store.TargetFile) error {
+	if tf.Status != "errored" && tf.Status != "failed" {
+		return fmt.Errorf("not errored or failed (%s)", tf.Status)
+	}
+	if err := h.applied(h.store.MarkResumed(tf.Path)); err != nil {
+		return err
+	}
+	h.wakeUp(tf.Path)
+	return nil
+}
+
+// requeueFile converts a file again from a clean slate: its error count,
+// chain step, intermediates, and outputs are forgotten. on_conflict still
+// applies to existing targets.
+func (h *converterHandler) requeueFile(tf *store.TargetFile) error {
+	if tf.Status == "in_flight" {
+		return errors.New("in_flight")
+	}
+	h.removeIntermediates(tf.Path)
+	if err := h.applied(h.store.Requeue(tf.Path)); err != nil {
+		return err
+	}
+	h.wakeUp(tf.Path)
+	return nil
+}
+
+// forceFile is requeueFile with the task submitted as force=true, so existing
+// targets are overwritten whatever on_conflict says.
+func (h *converterHandler) forceFile(tf *store.TargetFile) error {
+	h.keepForced(tf.Path)
+	if err := h.requeueFile(tf); err != nil {
+		h.unforce(tf.Path)
+		return err
+	}
+	return nil
+}
+
+// keepForced makes path's next submission carry force=true.
+func (h *converterHandler) keepForced(path string) {
+	h.mu.Lock()
+	h.forced[path] = true
+	h.mu.Unlock()
+}
+
+// isForced reports whether path's next submission carries force=true.
+func (h *converterHandler) isForced(path string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.forced[path]
+}
+
+func (h *converterHandler) unforce(path string) {
+	h.mu.Lock()
+	delete(h.forced, path)
+	h.mu.Unlock()
+}
+
+// applied turns the result of a conditional store update into an error for
+// fileOps.
+func (h *converterHandler) applied(ok bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errStatusChanged
+	}
+	return nil
+}
+
+// selectFiles returns the pipeline's files chosen by sel, and the listed
+// paths that are not among them.
+func (h *converterHandler) selectFiles(sel fileSelector) ([]*store.TargetFile, []skippedFile, error) {
+	var skipped []skippedFile
+	if len(sel.Paths) > 0 {
+		var files []*store.TargetFile
+		for _, path := range sel.Paths {
+			tf, err := h.store.GetByPath(path)
+			switch {
+			case errors.Is(err, sql.ErrNoRows) || (err == nil && tf.PipelineName != h.actionName):
+				skipped = append(skipped, skippedFile{Path: path, Reason: "not a file of this pipeline"})
+			case err != nil:
+				return nil, nil, err
+			case sel.Status != "" && tf.Status != sel.Status, sel.Glob != "" && !globMatch(sel.Glob, path):
+				skipped = append(skipped, skippedFile{Path: path, Reason: "does not match the filter"})
+			default:
+				files = append(files, tf)
+			}
+		}
+		return files, skipped, nil
+	}
+	all, err := h.store.ListTasks(h.actionName, sel.Status, 0, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := all[:0]
+	for _, tf := range all {
+		if sel.Glob == "" || globMatch(sel.Glob, tf.Path) {
+			files = append(files, tf)
+		}
+	}
+	return files, skipped, nil
+}
+
+func globMatch(pattern, path string) bool {
+	match, _ := doublestar.Match(pattern, path)
+	return match
+}
+
+// stopped handles a task of inputPath that was stopped on purpose: paused
+// when an operator stopped it, queued again when the process is shutting
+// down, so a restart does not strand the file. Either way a chain keeps its
+// step and a multi-output file its finished outputs, so the next run
+// continues where this one left off.
+func (h *converterHandler) stopped(inputPath string, out *outputConfig) {
+	pause := !h.stopping.Load()
+	if h.multiOutput() {
+		if err := h.store.MarkOutputQueued(inputPath, out.Name); err != nil {
+			log.Printf("[converter] requeue output %s of %s: %v", out.Name, inputPath, err)
+		}
+	}
+	if !pause {
+		if err := h.store.ResetInFlight(inputPath, "queued", ""); err != nil {
+			log.Printf("[converter] requeue %s: %v", inputPath, err)
+		}
+		log.Printf("[converter] %s stopped; queued again", inputPath)
+		return
+	}
+	if err := h.store.MarkPaused(inputPath); err != nil {
+		log.Printf("[converter] mark paused %s: %v", inputPath, err)
+	}
+	log.Printf("[converter] %s stopped; paused until resumed", inputPath)
+}
@@ -0,0 +1,47 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStoppedTaskIsRequeuedOnlyOnShutdown(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestHandler(t, dir, nil)
+	out := h.outputs()[0]
+
+	for _, shutdown := range []bool{false, true} {
+		input := filepath.Join(dir, "a.ts")
+		if err := os.WriteFile(input, []byte("input"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.store.UpsertQueued(input, h.actionName, filepath.Join(dir, "a.mp4"), nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := h.store.MarkInFlight(input, bootID); err != nil {
+			t.Fatal(err)
+		}
+
+		// The task is stopped, by an operator or by the shutdown.
+		h.stopping.Store(shutdown)
+		h.stopped(input, &out)
+
+		want := "paused"
+		if shutdown {
+			want = "queued"
+		}
+		tf, err := h.store.GetByPath(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tf.Status != want || tf.ErrorCount != 0 {
+			t.Errorf("shutdown %v: status %q with %d errors, want %q with none", shutdown, tf.Status, tf.ErrorCount, want)
+		}
+		if tf.Status == "paused" {
+			if err := h.resumeFile(tf); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
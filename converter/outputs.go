@@ -0,0 +1,154 @@
+package converter
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/whisper-darkly/sticky-converter/internal/executor"
+	"github.com/whisper-darkly/sticky-converter/internal/scanner"
+	"github.com/whisper-darkly/sticky-converter/internal/store"
+)
+
+// outputConfig is one rendition produced from each input. A pipeline without
+// an outputs list has a single unnamed output built from target and command.
+type outputConfig struct {
+	Name     string        `json:"name"`
+	Target   targetConfig  `json:"target"`
+	Command  string        `json:"command"`
+	Optional bool          `json:"optional"`         // the input can complete without it
+	Verify   *verifyConfig `json:"verify,omitempty"` // overrides config.verify for this output
+}
+
+// multiOutput reports whether the pipeline has an outputs list, whose entries
+// are submitted as separate tasks and tracked in target_outputs.
+func (h *converterHandler) multiOutput() bool { return len(h.cfg.Outputs) > 0 }
+
+// outputs returns the configured outputs, or the single implicit one.
+func (h *converterHandler) outputs() []outputConfig {
+	if h.multiOutput() {
+		return h.cfg.Outputs
+	}
+	return []outputConfig{{Target: h.cfg.Target, Command: h.cfg.Command, Verify: h.cfg.Verify}}
+}
+
+// output returns the output a task's "output" param names.
+func (h *converterHandler) output(name string) (*outputConfig, error) {
+	outputs := h.outputs()
+	if !h.multiOutput() {
+		if name != "" {
+			return nil, fmt.Errorf("pipeline has no outputs list, got output %q", name)
+		}
+		return &outputs[0], nil
+	}
+	for i := range outputs {
+		if outputs[i].Name == name {
+			return &outputs[i], nil
+		}
+	}
+	return nil, fmt.Errorf("unknown output %q", name)
+}
+
+// renderTargets renders the target path of every output of inputPath, in
+// h.outputs() order.
+func (h *converterHandler) renderTargets(inputPath string) ([]string, error) {
+	outputs := h.outputs()
+	targets := make([]string, len(outputs))
+	for i, out := range outputs {
+		t, err := h.renderTarget(inputPath, out.Target)
+		if err != nil {
+			if out.Name != "" {
+				return nil, fmt.Errorf("output %s: %w", out.Name, err)
+			}
+			return nil, err
+		}
+		targets[i] = t
+	}
+	return targets, nil
+}
+
+// renderTarget renders target for inputPath.
+func (h *converterHandler) renderTarget(inputPath string, target targetConfig) (string, error) {
+	return executor.RenderTarget(target.Regex, target.Format, h.fileVars(inputPath), h.actionName)
+}
+
+// fileVars returns the template file variables of path, with the relative
+// fields relative to the base of the glob it matches.
+func (h *converterHandler) fileVars(path string) executor.FileVars {
+	fv := executor.NewFileVars(path)
+	if base, _, ok := scanner.RelativeTo(h.cfg.Paths, path); ok {
+		fv = fv.WithBase(base)
+	}
+	return fv
+}
+
+// finishOutput records the outcome of one output of a multi-output pipeline.
+// A failed required output errors the whole input; otherwise the input's
+// status is derived from all of its outputs.
+func (h *converterHandler) finishOutput(inputPath string, out *outputConfig, errMsg string) {
+	if errMsg == "" {
+		if err := h.store.MarkOutputCompleted(inputPath, out.Name); err != nil {
+			log.Printf("[converter] mark output %s completed %s: %v", out.Name, inputPath, err)
+		}
+		h.settleOutputs(inputPath, true)
+		return
+	}
+	if err := h.store.MarkOutputErrored(inputPath, out.Name, errMsg); err != nil {
+		log.Printf("[converter] mark output %s errored %s: %v", out.Name, inputPath, err)
+	}
+	if out.Optional {
+		log.Printf("[converter] optional output %s of %s failed: %s", out.Name, inputPath, errMsg)
+		h.settleOutputs(inputPath, true)
+		return
+	}
+	if err := h.store.MarkErrored(inputPath, fmt.Sprintf("output %s: %s", out.Name, errMsg)); err != nil {
+		log.Printf("[converter] mark errored %s: %v", inputPath, err)
+	}
+	h.failIfExhausted(inputPath)
+}
+
+// settleOutputs marks inputPath completed once every required output has
+// completed, every optional one has completed or failed at least once, and
+// none is still running; with dispose set, source_disposition is then
+// applied. If work remains and nothing is running, an in_flight input goes
+// back to queued so the next scan submits the rest.
+func (h *converterHandler) settleOutputs(inputPath string, dispose bool) {
+	rows, err := h.store.ListOutputs(inputPath)
+	if err != nil {
+		log.Printf("[converter] list outputs %s: %v", inputPath, err)
+		return
+	}
+	byName := make(map[string]*store.TargetOutput, len(rows))
+	running := false
+	for _, o := range rows {
+		byName[o.Name] = o
+		if o.Status == "in_flight" {
+			running = true
+		}
+	}
+	done := true
+	for _, out := range h.cfg.Outputs {
+		o := byName[out.Name]
+		switch {
+		case o != nil && o.Status == "completed":
+		case out.Optional && o != nil && o.Status == "errored":
+		default:
+			done = false
+		}
+	}
+
+	switch {
+	case running:
+	case done:
+		if err := h.store.MarkCompleted(inputPath); err != nil {
+			log.Printf("[converter] mark completed %s: %v", inputPath, err)
+			return
+		}
+		if dispose {
+			h.disposeSource(inputPath)
+		}
+	default:
+		if err := h.store.ResetInFlight(inputPath, "queued", ""); err != nil {
+			log.Printf("[converter] requeue %s: %v", inputPath, err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package converter
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+
+	"github.com/whisper-darkly/sticky-converter/internal/executor"
+	overseer "github.com/whisper-darkly/sticky-overseer/v2"
+)
+
+// taskParams are the optional per-task overrides a manual start may pass
+// alongside "file". Tasks submitted by the scanner carry none of them.
+type taskParams struct {
+	target   string         // output path replacing the rendered target
+	extra    map[string]any // merged over the pipeline's extra; null removes a key
+	priority *int           // niceness of the worker process, 0 to 19
+	force    bool           // convert again even if already completed
+}
+
+// optionalParams are the overrides declared in Describe.
+var optionalParams = []string{"target", "extra", "priority", "force"}
+
+func optionalParam() *overseer.ParamSpec {
+	empty := ""
+	return &overseer.ParamSpec{Default: &empty}
+}
+
+func parseTaskParams(params map[string]string) (taskParams, error) {
+	var tp taskParams
+	if t := params["target"]; t != "" {
+		if !filepath.IsAbs(t) {
+			return tp, fmt.Errorf("target %q must be an absolute path", t)
+		}
+		tp.target = filepath.Clean(t)
+	}
+	if e := params["extra"]; e != "" {
+		if err := json.Unmarshal([]byte(e), &tp.extra); err != nil {
+			return tp, fmt.Errorf("extra must be a JSON object: %w", err)
+		}
+	}
+	if p := params["priority"]; p != "" {
+		n, err := strconv.Atoi(p)
+		// Negative niceness needs privileges the worker usually lacks, so it
+		// would only fail once the command runs.
+		if err != nil || n < 0 || n > 19 {
+			return tp, fmt.Errorf("priority %q must be an integer from 0 to 19", p)
+		}
+		tp.priority = &n
+	}
+	if f := params["force"]; f != "" {
+		force, err := strconv.ParseBool(f)
+		if err != nil {
+			return tp, fmt.Errorf("force %q must be a boolean", f)
+		}
+		tp.force = force
+	}
+	return tp, nil
+}
+
+// withExtra returns extra with the task's overrides applied.
+func (tp taskParams) withExtra(extra executor.Extra) executor.Extra {
+	for k, v := range tp.extra {
+		if v == nil {
+			delete(extra, k)
+		} else {
+			extra[k] = v
+		}
+	}
+	return extra
+}
+
+// vars returns the params as command template data.
+func (tp taskParams) vars() executor.TaskVars {
+	v := executor.TaskVars{Target: tp.target, Force: tp.force, Extra: tp.extra}
+	if tp.priority != nil {
+		v.Priority = *tp.priority
+	}
+	return v
+}
+
+// withPriority runs argv under nice(1) when the task sets a priority.
+func (tp taskParams) withPriority(argv []string) []string {
+	if tp.priority == nil {
+		return argv
+	}
+	return append([]string{"nice", "-n", strconv.Itoa(*tp.priority)}, argv...)
+}
+
+// prepareRow makes sure inputPath has a target_files row, creating one for a
+// file no scan has seen yet. Unless force is set, it refuses paused files and
+// completed ones (or, in a multi-output pipeline, completed outputs).
+func (h *converterHandler) prepareRow(inputPath string, out *outputConfig, target string, force bool) error {
+	tf, err := h.store.GetByPath(inputPath)
+	if errors.Is(err, sql.ErrNoRows) {
+		return h.store.UpsertQueued(inputPath, h.actionName, target, h.sourceFingerprint(inputPath))
+	}
+	if err != nil {
+		return err
+	}
+	completed := tf.Status == "completed"
+	if h.multiOutput() {
+		rows, err := h.store.ListOutputs(inputPath)
+		if err != nil {
+			return err
+		}
+		completed = false
+		for _, row := range rows {
+			if row.Name == out.Name {
+				completed = row.Status == "completed"
+			}
+		}
+	}
+	if completed && !force {
+		return fmt.Errorf("%s is already completed; pass force=true to convert it again", inputPath)
+	}
+	if tf.Status == "paused" && !force {
+		return fmt.Errorf("%s is paused; resume it or pass force=true", inputPath)
+	}
+	return nil
+}
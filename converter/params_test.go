@@ -0,0 +1,40 @@
+package converter
+
+import "testing"
+
+func TestParseTaskParamsPriority(t *testing.T) {
+	for _, p := range []string{"0", "10", "19"} {
+		tp, err := parseTaskParams(map[string]string{"priority": p})
+		if err != nil {
+			t.Errorf("priority %s: %v", p, err)
+			continue
+		}
+		if got := tp.withPriority([]string{"ffmpeg"}); len(got) != 4 || got[2] != p {
+			t.Errorf("priority %s: argv %q", p, got)
+		}
+	}
+	for _, p := range []string{"-1", "-20", "20", "x"} {
+		if _, err := parseTaskParams(map[string]string{"priority": p}); err == nil {
+			t.Errorf("priority %s accepted", p)
+		}
+	}
+}
+
+func TestTaskParamsVars(t *testing.T) {
+	tp, err := parseTaskParams(map[string]string{
+		"target":   "/out/x.mp4",
+		"extra":    `{"crf": 18}`,
+		"priority": "5",
+		"force":    "true",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := tp.vars()
+	if v.Target != "/out/x.mp4" || v.Priority != 5 || !v.Force || v.Extra["crf"] != float64(18) {
+		t.Fatalf("vars %+v", v)
+	}
+	if v := (taskParams{}).vars(); v.Target != "" || v.Priority != 0 || v.Force || v.Extra != nil {
+		t.Fatalf("vars without params %+v", v)
+	}
+}
@@ -0,0 +1,144 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/whisper-darkly/sticky-converter/internal/probe"
+	"github.com/whisper-darkly/sticky-converter/internal/store"
+)
+
+// progressWriteInterval bounds how often progress is written to the store.
+const progressWriteInterval = 2 * time.Second
+
+// progressTracker parses the key=value blocks ffmpeg writes with
+// `-progress pipe:1`. Each block ends with a progress=continue|end line.
+type progressTracker struct {
+	mu        sync.Mutex
+	duration  time.Duration // input duration; 0 if unknown
+	outTime   time.Duration
+	fps       float64
+	speed     float64
+	lastWrite time.Time
+}
+
+func newProgressTracker(duration time.Duration) *progressTracker {
+	return &progressTracker{duration: duration}
+}
+
+// Feed consumes a chunk of progress output. It returns a snapshot when a block
+// completed and either the block was the final one or progressWriteInterval
+// has passed since the last returned snapshot.
+func (p *progressTracker) Feed(chunk string) (store.Progress, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var snap store.Progress
+	ready := false
+	for _, line := range strings.Split(chunk, "\n") {
+		key, val, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "out_time_us", "out_time_ms": // both are microseconds
+			if us, err := strconv.ParseInt(val, 10, 64); err == nil && us >= 0 {
+				p.outTime = time.Duration(us) * time.Microsecond
+			}
+		case "fps":
+			if f, err := strconv.ParseFloat(val, 64); err == nil {
+				p.fps = f
+			}
+		case "speed":
+			if f, err := strconv.ParseFloat(strings.TrimSuffix(val, "x"), 64); err == nil {
+				p.speed = f
+			}
+		case "progress":
+			now := time.Now()
+			if val != "end" && now.Sub(p.lastWrite) < progressWriteInterval {
+				continue
+			}
+			p.lastWrite = now
+			snap = p.snapshot(val == "end")
+			ready = true
+		}
+	}
+	return snap, ready
+}
+
+func (p *progressTracker) snapshot(done bool) store.Progress {
+	snap := store.Progress{
+		OutTime:   p.outTime,
+		FPS:       p.fps,
+		Speed:     p.speed,
+		UpdatedAt: time.Now(),
+	}
+	if p.duration > 0 {
+		snap.Percent = 100 * float64(p.outTime) / float64(p.duration)
+		if snap.Percent > 100 || done {
+			snap.Percent = 100
+		}
+		if remaining := p.duration - p.outTime; remaining > 0 && p.speed > 0 && !done {
+			snap.ETA = time.Duration(float64(remaining) / p.speed)
+		}
+	}
+	return snap
+}
+
+// formatProgress renders a snapshot as a one-line event message.
+func formatProgress(p store.Progress) string {
+	msg := fmt.Sprintf("progress time=%s fps=%.1f speed=%.2fx", p.OutTime.Truncate(time.Second), p.FPS, p.Speed)
+	if p.Percent > 0 {
+		msg = fmt.Sprintf("progress %.1f%% time=%s fps=%.1f speed=%.2fx eta=%s",
+			p.Percent, p.OutTime.Truncate(time.Second), p.FPS, p.Speed, p.ETA.Truncate(time.Second))
+	}
+	return msg
+}
+
+// withProgressArgs adds `-progress pipe:1 -nostats` right after the ffmpeg
+// binary so they apply as global options. It reports false, leaving argv
+// alone, when argv is not an ffmpeg command or already writes an output to
+// stdout; "-i -" reads stdin and does not count. A command with its own
+// -progress reports true only if that goes to stdout.
+func withProgressArgs(argv []string) ([]string, bool) {
+	if !strings.HasPrefix(filepath.Base(argv[0]), "ffmpeg") {
+		return argv, false
+	}
+	for i := 1; i < len(argv); i++ {
+		switch argv[i] {
+		case "-i":
+			i++ // an input read from stdin, not an output
+		case "-progress":
+			return argv, i+1 < len(argv) && isStdout(argv[i+1])
+		case "-", "pipe:", "pipe:1":
+			return argv, false
+		}
+	}
+	out := make([]string, 0, len(argv)+3)
+	out = append(out, argv[0], "-progress", "pipe:1", "-nostats")
+	return append(out, argv[1:]...), true
+}
+
+// isStdout reports whether an ffmpeg output URL is stdout.
+func isStdout(url string) bool {
+	return url == "-" || url == "pipe:" || url == "pipe:1"
+}
+
+// probeDuration returns the input's duration via ffprobe, or 0 if it cannot be
+// determined.
+func (h *converterHandler) probeDuration(inputPath string) time.Duration {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	res, err := probe.Probe(ctx, h.cfg.FFprobe, inputPath)
+	if err != nil {
+		log.Printf("[converter] probe %s: %v", inputPath, err)
+		return 0
+	}
+	return time.Duration(res.Duration * float64(time.Second))
+}
@@ -0,0 +1,32 @@
+package converter
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWithProgressArgs(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string // argv after the call, joined
+		ok   bool
+	}{
+		{"ffmpeg -i in.ts out.mp4", "ffmpeg -progress pipe:1 -nostats -i in.ts out.mp4", true},
+		{"ffmpeg -progress pipe:1 -i in.ts out.mp4", "ffmpeg -progress pipe:1 -i in.ts out.mp4", true},
+		{"ffmpeg -progress - -i in.ts out.mp4", "ffmpeg -progress - -i in.ts out.mp4", true},
+		{"ffmpeg -progress /tmp/progress.txt -i in.ts out.mp4", "ffmpeg -progress /tmp/progress.txt -i in.ts out.mp4", false},
+		{"ffmpeg -progress tcp://127.0.0.1:9000 -i in.ts out.mp4", "ffmpeg -progress tcp://127.0.0.1:9000 -i in.ts out.mp4", false},
+		{"ffmpeg -i in.ts -f mpegts pipe:1", "ffmpeg -i in.ts -f mpegts pipe:1", false},
+		{"ffmpeg -i - out.mp4", "ffmpeg -progress pipe:1 -nostats -i - out.mp4", true},
+		{"ffmpeg -f mpegts -i pipe: -c copy out.mp4", "ffmpeg -progress pipe:1 -nostats -f mpegts -i pipe: -c copy out.mp4", true},
+		{"ffmpeg -i - -f mpegts -", "ffmpeg -i - -f mpegts -", false},
+		{"HandBrakeCLI -i in.ts -o out.mp4", "HandBrakeCLI -i in.ts -o out.mp4", false},
+	}
+	for _, tt := range tests {
+		argv, ok := withProgressArgs(strings.Fields(tt.cmd))
+		if ok != tt.ok || !slices.Equal(argv, strings.Fields(tt.want)) {
+			t.Errorf("withProgressArgs(%q) = %q, %v; want %q, %v", tt.cmd, strings.Join(argv, " "), ok, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package converter
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/whisper-darkly/sticky-converter/internal/store"
+)
+
+// File listings return at most maxPageSize files per request.
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// fileStatuses are the values of target_files.status.
+var fileStatuses = []string{"queued", "in_flight", "completed", "errored", "failed", "paused"}
+
+// fileJSON is a target_files row as returned by the API.
+type fileJSON struct {
+	Path            string        `json:"path"`
+	Pipeline        string        `json:"pipeline"`
+	Status          string        `json:"status"`
+	ErrorCount      int           `json:"error_count"`
+	ErrorMessage    string        `json:"error_message,omitempty"`
+	TargetPath      string        `json:"target_path,omitempty"`
+	Step            int           `json:"step,omitempty"`
+	HoldReason      string        `json:"hold_reason,omitempty"`
+	QueuedAt        time.Time     `json:"queued_at"`
+	StartedAt       *time.Time    `json:"started_at,omitempty"`
+	CompletedAt     *time.Time    `json:"completed_at,omitempty"`
+	LastAttemptedAt *time.Time    `json:"last_attempted_at,omitempty"`
+	Progress        *progressJSON `json:"progress,omitempty"`
+}
+
+type progressJSON struct {
+	Percent   float64   `json:"percent"`
+	OutTimeMS int64     `json:"out_time_ms"`
+	FPS       float64   `json:"fps"`
+	Speed     float64   `json:"speed"`
+	ETAMS     int64     `json:"eta_ms"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newFileJSON(tf *store.TargetFile) fileJSON {
+	f := fileJSON{
+		Path:            tf.Path,
+		Pipeline:        tf.PipelineName,
+		Status:          tf.Status,
+		ErrorCount:      tf.ErrorCount,
+		ErrorMessage:    tf.ErrorMessage,
+		TargetPath:      tf.TargetPath,
+		Step:            tf.Step,
+		HoldReason:      tf.HoldReason,
+		QueuedAt:        tf.QueuedAt,
+		StartedAt:       tf.StartedAt,
+		CompletedAt:     tf.CompletedAt,
+		LastAttemptedAt: tf.LastAttemptedAt,
+	}
+	if p := tf.Progress; p != nil {
+		f.Progress = &progressJSON{
+			Percent:   p.Percent,
+			OutTimeMS: p.OutTime.Milliseconds(),
+			FPS:       p.FPS,
+			Speed:     p.Speed,
+			ETAMS:     p.ETA.Milliseconds(),
+			UpdatedAt: p.UpdatedAt,
+		}
+	}
+	return f
+}
+
+type fileListJSON struct {
+	Files  []fileJSON `json:"files"`
+	Total  int        `json:"total"` // matches before paging
+	Limit  int        `json:"limit"`
+	Offset int        `json:"offset"`
+}
+
+// statsJSON holds a pipeline's file counts by status.
+type statsJSON struct {
+	Pipeline  string `json:"pipeline"`
+	State     string `json:"state"`
+	Total     int    `json:"total"`
+	Queued    int    `json:"queued"`
+	InFlight  int    `json:"in_flight"`
+	Completed int    `json:"completed"`
+	Errored   int    `json:"errored"`
+	Failed    int    `json:"failed"`
+	Paused    int    `json:"paused"`
+}
+
+// listFiles serves GET /pipelines/{name}/files.
+func (s *apiServer) listFiles(w http.ResponseWriter, r *http.Request) {
+	h := s.pipeline(w, r)
+	if h == nil {
+		return
+	}
+	q, err := parseTaskQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	q.Pipeline = h.actionName
+	files, total, err := h.store.QueryTasks(q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	resp := fileListJSON{Files: make([]fileJSON, len(files)), Total: total, Limit: q.Limit, Offset: q.Offset}
+	for i, tf := range files {
+		resp.Files[i] = newFileJSON(tf)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// parseTaskQuery reads the filters, sorting, and paging of a file listing.
+func parseTaskQuery(v url.Values) (store.TaskQuery, error) {
+	q := store.TaskQuery{
+		PathPrefix: v.Get("prefix"),
+		Sort:       v.Get("sort"),
+		Limit:      defaultPageSize,
+	}
+	if st := v.Get("status"); st != "" {
+		q.Statuses = strings.Split(st, ",")
+		for _, s := range q.Statuses {
+			if !slices.Contains(fileStatuses, s) {
+				return q, fmt.Errorf("unknown status %q", s)
+			}
+		}
+	}
+	if q.Sort != "" && !slices.Contains(store.TaskSortFields, q.Sort) {
+		return q, fmt.Errorf("sort must be one of %s", strings.Join(store.TaskSortFields, ", "))
+	}
+	switch v.Get("order") {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+	ints := []struct {
+		name string
+		dst  *int
+	}{
+		{"min_errors", &q.MinErrors},
+		{"limit", &q.Limit},
+		{"offset", &q.Offset},
+	}
+	for _, p := range ints {
+		if s := v.Get(p.name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return q, fmt.Errorf("%s must be a non-negative integer", p.name)
+			}
+			*p.dst = n
+		}
+	}
+	if s := v.Get("max_errors"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return q, fmt.Errorf("max_errors must be a non-negative integer")
+		}
+		q.MaxErrors = &n
+	}
+	if q.Limit == 0 || q.Limit > maxPageSize {
+		q.Limit = maxPageSize
+	}
+	return q, nil
+}
+
+// pipelineStats serves GET /pipelines/{name}/stats.
+func (s *apiServer) pipelineStats(w http.ResponseWriter, r *http.Request) {
+	h := s.pipeline(w, r)
+	if h == nil {
+		return
+	}
+	st, err := h.stats()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
+
+// allStats serves GET /stats: the counts of every pipeline on this address.
+func (s *apiServer) allStats(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	handlers := make([]*converterHandler, 0, len(s.pipelines))
+	for _, h := range s.pipelines {
+		handlers = append(handlers, h)
+	}
+	s.mu.RUnlock()
+	sort.Slice(handlers, func(i, j int) bool { return handlers[i].actionName < handlers[j].actionName })
+
+	all := make([]statsJSON, 0, len(handlers))
+	for _, h := range handlers {
+		st, err := h.stats()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		all = append(all, st)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"pipelines": all})
+}
+
+func (h *converterHandler) stats() (statsJSON, error) {
+	st, err := h.store.GetPipelineStats(h.actionName)
+	if err != nil {
+		return statsJSON{}, err
+	}
+	return statsJSON{
+		Pipeline:  h.actionName,
+		State:     h.state(),
+		Total:     st.Queued + st.InFlight + st.Completed + st.Errored + st.Failed + st.Paused,
+		Queued:    st.Queued,
+		InFlight:  st.InFlight,
+		Completed: st.Completed,
+		Errored:   st.Errored,
+		Failed:    st.Failed,
+		Paused:    st.Paused,
+	}, nil
+}
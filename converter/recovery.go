@@ -0,0 +1,146 @@
+package converter
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/whisper-darkly/sticky-converter/internal/store"
+)
+
+// bootID identifies this process in target_files.boot_id. Rows left in_flight
+// under any other boot ID belong to a previous (or foreign) process.
+var bootID = newBootID()
+
+func newBootID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+	}
+	return fmt.Sprintf("%d-%s", os.Getpid(), hex.EncodeToString(b))
+}
+
+// heartbeatInterval returns how often this process refreshes the heartbeat of
+// its in_flight rows: every scan, and at least four times per stale_after so a
+// peer never takes a live row for an orphan.
+func heartbeatInterval(scanInterval, staleAfter time.Duration) time.Duration {
+	if staleAfter > 0 && staleAfter/4 < scanInterval {
+		return max(staleAfter/4, time.Second)
+	}
+	return scanInterval
+}
+
+// heartbeat refreshes the heartbeat of this process's in_flight rows every
+// interval until ctx is cancelled. It runs on its own goroutine, so a long
+// scan does not delay it.
+func (h *converterHandler) heartbeat(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := h.store.Heartbeat(bootID); err != nil {
+				log.Printf("[converter] heartbeat: %v", err)
+			}
+		}
+	}
+}
+
+// recoverOrphaned resets in_flight rows left behind by a previous process and
+// removes any partial output they may have written. With stale_after unset,
+// every row not owned by this process is recovered; set it when several
+// processes share one database so live peers are not disturbed.
+func (h *converterHandler) recoverOrphaned() {
+	staleBefore := time.Now().Add(-h.cfg.StaleAfter.Duration)
+	orphans, err := h.store.ListOrphaned(h.actionName, bootID, staleBefore)
+	if err != nil {
+		log.Printf("[converter] list orphaned: %v", err)
+		return
+	}
+
+	for _, tf := range orphans {
+		if partials, err := h.interruptedOutputs(tf); err == nil {
+			for _, partial := range partials {
+				if err := removeFileWithRetry(partial, 4, 250*time.Millisecond); err != nil {
+					log.Printf("[converter] remove partial output %s: %v", partial, err)
+				}
+			}
+		} else {
+			log.Printf("[converter] find partial output of %s: %v", tf.Path, err)
+		}
+
+		owner := tf.BootID
+		if owner == "" {
+			owner = "unknown"
+		}
+		msg := fmt.Sprintf("interrupted: process %s exited while conversion was in flight", owner)
+		if err := h.store.ResetInFlight(tf.Path, h.cfg.RecoverAs, msg); err != nil {
+			log.Printf("[converter] recover %s: %v", tf.Path, err)
+			continue
+		}
+		if err := h.store.ResetInFlightOutputs(tf.Path, h.cfg.RecoverAs, msg); err != nil {
+			log.Printf("[converter] recover outputs %s: %v", tf.Path, err)
+		}
+		if err := h.store.AbandonAttempts(tf.Path, msg); err != nil {
+			log.Printf("[converter] abandon attempts %s: %v", tf.Path, err)
+		}
+		log.Printf("[converter] recovered orphaned %s → %s", tf.Path, h.cfg.RecoverAs)
+	}
+}
+
+// interruptedOutputs returns the files the interrupted run(s) of tf may have
+// left half-written: the output paths of its unfinished attempts, falling back
+// to the outputs still marked in_flight or, for a single-output pipeline, the
+// rendered target. Attempt paths differ from the rendered ones when
+// on_conflict is "suffix". Intermediate chain steps are returned as written;
+// final outputs map to their staged file when atomic_output is on.
+func (h *converterHandler) interruptedOutputs(tf *store.TargetFile) ([]string, error) {
+	var out []string
+	add := func(path string, intermediate bool) {
+		if h.cfg.AtomicOutput && !intermediate {
+			// The target is only ever written by rename, so only the
+			// staged file can be partial.
+			path = stagingPath(path, h.cfg.StagingDir)
+		}
+		out = append(out, path)
+	}
+
+	if attempts, err := h.store.ListAttempts(tf.Path); err == nil {
+		for _, a := range attempts {
+			if a.EndedAt == nil && a.OutputPath != "" {
+				add(a.OutputPath, a.Step != nil && *a.Step < len(h.cfg.Steps)-1)
+			}
+		}
+	}
+	if len(out) > 0 {
+		return out, nil
+	}
+
+	if !h.multiOutput() {
+		targets, err := h.renderTargets(tf.Path)
+		if err != nil {
+			return nil, err
+		}
+		if h.chained() && tf.Step < len(h.cfg.Steps)-1 {
+			return []string{h.stepPath(targets[0], tf.Step)}, nil
+		}
+		add(targets[0], false)
+		return out, nil
+	}
+	rows, err := h.store.ListOutputs(tf.Path)
+	if err != nil {
+		return nil, err
+	}
+	for _, o := range rows {
+		if o.Status == "in_flight" && o.OutputPath != "" {
+			add(o.OutputPath, false)
+		}
+	}
+	return out, nil
+}
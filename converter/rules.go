@@ -0,0 +1,126 @@
+package converter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/whisper-darkly/sticky-converter/internal/executor"
+	"github.com/whisper-darkly/sticky-converter/internal/probe"
+)
+
+// ruleConfig picks the command for inputs whose media match a condition.
+type ruleConfig struct {
+	When    string `json:"when,omitempty"` // CEL expression; empty matches every input
+	Command string `json:"command"`
+}
+
+// rule is a ruleConfig with its condition compiled.
+type rule struct {
+	ruleConfig
+	prg cel.Program // nil when When is empty
+}
+
+// ruleEnv declares the variables available to rule conditions: the fields of
+// probe.Result.Vars plus file and extra.
+func ruleEnv() (*cel.Env, error) {
+	dynMap := cel.MapType(cel.StringType, cel.DynType)
+	return cel.NewEnv(
+		cel.Variable("duration", cel.DoubleType),
+		cel.Variable("bitrate", cel.IntType),
+		cel.Variable("format", cel.StringType),
+		cel.Variable("video", dynMap),
+		cel.Variable("audio", dynMap),
+		cel.Variable("streams", cel.ListType(dynMap)),
+		cel.Variable("file", dynMap),
+		cel.Variable("extra", dynMap),
+	)
+}
+
+// compileRules compiles every condition, so mistakes surface at startup.
+func compileRules(cfgs []ruleConfig) ([]rule, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+	env, err := ruleEnv()
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]rule, len(cfgs))
+	for i, rc := range cfgs {
+		if rc.Command == "" {
+			return nil, fmt.Errorf("rules[%d].command is required", i)
+		}
+		rules[i].ruleConfig = rc
+		if rc.When == "" {
+			continue
+		}
+		ast, iss := env.Compile(rc.When)
+		if iss.Err() != nil {
+			return nil, fmt.Errorf("rules[%d].when: %w", i, iss.Err())
+		}
+		if !ast.OutputType().IsExactType(cel.BoolType) {
+			return nil, fmt.Errorf("rules[%d].when must be a bool expression, got %s", i, ast.OutputType())
+		}
+		if rules[i].prg, err = env.Program(ast); err != nil {
+			return nil, fmt.Errorf("rules[%d].when: %w", i, err)
+		}
+	}
+	return rules, nil
+}
+
+// probes reports whether inputs are probed before each conversion.
+func (h *converterHandler) probes() bool { return h.cfg.Probe || len(h.rules) > 0 }
+
+// probeInput runs ffprobe against inputPath.
+func (h *converterHandler) probeInput(inputPath string) (*probe.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return probe.Probe(ctx, h.cfg.FFprobe, inputPath)
+}
+
+// pickCommand returns the command of the first rule whose condition holds for
+// vars, or fallback if none does. A condition that fails to evaluate, such as
+// one reading video.codec on a file without video, counts as not matching.
+func (h *converterHandler) pickCommand(inputPath string, vars map[string]any, fallback string) (string, error) {
+	for i, r := range h.rules {
+		if r.prg == nil {
+			return r.Command, nil
+		}
+		out, _, err := r.prg.Eval(vars)
+		if err != nil {
+			log.Printf("[converter] %s: rules[%d]: %v", inputPath, i, err)
+			continue
+		}
+		if match, ok := out.Value().(bool); ok && match {
+			return r.Command, nil
+		}
+	}
+	if fallback == "" {
+		return "", errors.New("no rule matched and config.command is not set")
+	}
+	return fallback, nil
+}
+
+// ruleVars returns the variables rule conditions are evaluated against.
+func ruleVars(media map[string]any, fv executor.FileVars, extra executor.Extra) map[string]any {
+	vars := maps.Clone(media)
+	vars["file"] = map[string]any{
+		"path":     fv.Path,
+		"name":     fv.Name,
+		"basename": fv.Basename,
+		"ext":      fv.Ext,
+		"dir":      fv.Dir,
+		"rel_path": fv.RelPath,
+		"size":     fv.Size,
+	}
+	if extra == nil {
+		extra = executor.Extra{}
+	}
+	vars["extra"] = map[string]any(extra)
+	return vars
+}
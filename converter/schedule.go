@@ -0,0 +1,134 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // schedule.timezone must resolve in images without zoneinfo
+)
+
+// scheduleConfig limits when a pipeline submits work.
+type scheduleConfig struct {
+	Timezone string         `json:"timezone,omitempty"` // IANA name (default: the process's local time)
+	Windows  []windowConfig `json:"windows"`
+}
+
+// windowConfig is a daily time range on some weekdays.
+type windowConfig struct {
+	Days  []string `json:"days,omitempty"` // "mon" … "sun" (default: every day)
+	Start string   `json:"start"`          // "HH:MM"
+	End   string   `json:"end"`            // "HH:MM"; at or before start, the window runs past midnight
+}
+
+// schedule is a parsed scheduleConfig. A nil *schedule is always open.
+type schedule struct {
+	loc     *time.Location
+	windows []window
+}
+
+type window struct {
+	days       [7]bool // indexed by time.Weekday: the day the window starts
+	start, end int     // minutes since midnight
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseSchedule(cfg *scheduleConfig) (*schedule, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	s := &schedule{loc: time.Local}
+	if cfg.Timezone != "" {
+		loc, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("timezone: %w", err)
+		}
+		s.loc = loc
+	}
+	if len(cfg.Windows) == 0 {
+		return nil, fmt.Errorf("windows is required")
+	}
+	for i, wc := range cfg.Windows {
+		var w window
+		var err error
+		if w.start, err = parseClock(wc.Start); err != nil {
+			return nil, fmt.Errorf("windows[%d].start: %w", i, err)
+		}
+		if w.end, err = parseClock(wc.End); err != nil {
+			return nil, fmt.Errorf("windows[%d].end: %w", i, err)
+		}
+		if len(wc.Days) == 0 {
+			w.days = [7]bool{true, true, true, true, true, true, true}
+		}
+		for _, d := range wc.Days {
+			wd, ok := weekdays[strings.ToLower(d)]
+			if !ok {
+				return nil, fmt.Errorf("windows[%d].days: unknown day %q", i, d)
+			}
+			w.days[wd] = true
+		}
+		s.windows = append(s.windows, w)
+	}
+	return s, nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("want HH:MM, got %q", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// open reports whether t falls inside a window.
+func (s *schedule) open(t time.Time) bool {
+	if s == nil {
+		return true
+	}
+	t = t.In(s.loc)
+	minute := t.Hour()*60 + t.Minute()
+	today, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	for _, w := range s.windows {
+		if w.start < w.end {
+			if w.days[today] && minute >= w.start && minute < w.end {
+				return true
+			}
+			continue
+		}
+		// Past midnight: the part after start today, or the rest of
+		// yesterday's window.
+		if (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextOpen returns when the next window opens, with ok false if one is open
+// at t or there is no schedule.
+func (s *schedule) nextOpen(t time.Time) (next time.Time, ok bool) {
+	if s == nil || s.open(t) {
+		return time.Time{}, false
+	}
+	local := t.In(s.loc)
+	for d := 0; d <= 7; d++ {
+		day := local.AddDate(0, 0, d)
+		for _, w := range s.windows {
+			if !w.days[day.Weekday()] {
+				continue
+			}
+			at := time.Date(day.Year(), day.Month(), day.Day(), w.start/60, w.start%60, 0, 0, s.loc)
+			if at.After(t) && (!ok || at.Before(next)) {
+				next, ok = at, true
+			}
+		}
+		if ok {
+			return next, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,168 @@
+package converter
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stabilityConfig describes when a scanned file counts as fully written. Every
+// configured check must pass.
+type stabilityConfig struct {
+	Scans       int      `json:"scans,omitempty"`        // consecutive observations with unchanged size and mtime
+	QuietPeriod duration `json:"quiet_period,omitempty"` // how long size and mtime must stay unchanged
+	OpenWriters bool     `json:"open_writers"`           // hold files some process has open for writing (via /proc)
+	DoneMarker  string   `json:"done_marker,omitempty"`  // template for a sidecar file that must exist
+}
+
+// observation is the last size and mtime seen for a file.
+type observation struct {
+	size    int64
+	modTime time.Time
+	count   int       // consecutive scans that saw this size and mtime
+	since   time.Time // first observation with this size and mtime
+	seen    time.Time // latest observation
+}
+
+// stabilityCheck applies a stabilityConfig across scans. It is only used from
+// the RunService goroutine.
+type stabilityCheck struct {
+	cfg          *stabilityConfig
+	render       func(path string, target targetConfig) (string, error)
+	observations map[string]*observation
+	counting     bool            // the current batch is a full scan, which counts toward scans
+	writers      map[string]bool // files open for writing, read once per batch when first needed
+}
+
+func newStabilityCheck(cfg *stabilityConfig, render func(string, targetConfig) (string, error)) *stabilityCheck {
+	return &stabilityCheck{cfg: cfg, render: render, observations: make(map[string]*observation)}
+}
+
+// beginBatch starts a batch of settled calls. Only a batch from a full scan
+// counts toward cfg.Scans; other batches, such as filesystem events, see a
+// file pass only once enough scans have counted it.
+func (c *stabilityCheck) beginBatch(fullScan bool) {
+	if c == nil {
+		return
+	}
+	c.counting = fullScan
+	c.writers = nil
+}
+
+// settled records an observation of path and reports whether it has passed
+// every configured check.
+func (c *stabilityCheck) settled(path string, now time.Time) bool {
+	if c == nil {
+		return true
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		delete(c.observations, path)
+		return false
+	}
+
+	o := c.observations[path]
+	if o == nil || o.size != fi.Size() || !o.modTime.Equal(fi.ModTime()) {
+		o = &observation{size: fi.Size(), modTime: fi.ModTime(), since: now}
+		c.observations[path] = o
+	}
+	if c.counting {
+		o.count++
+	}
+	o.seen = now
+
+	if c.cfg.Scans > 0 && o.count < c.cfg.Scans {
+		return false
+	}
+	if q := c.cfg.QuietPeriod.Duration; q > 0 && now.Sub(o.since) < q {
+		return false
+	}
+	if c.cfg.OpenWriters {
+		if c.writers == nil {
+			c.writers = openForWrite()
+		}
+		if c.writers[path] {
+			return false
+		}
+	}
+	if c.cfg.DoneMarker != "" {
+		marker, err := c.render(path, targetConfig{Format: c.cfg.DoneMarker})
+		if err != nil {
+			log.Printf("[converter] render done_marker for %s: %v", path, err)
+			return false
+		}
+		if _, err := os.Stat(marker); err != nil {
+			return false
+		}
+	}
+	// The observation is kept: a file that passes but is then held (by a
+	// target collision, admission control, or the pipeline state) stays
+	// settled on the next scan. prune drops it once it is no longer scanned.
+	return true
+}
+
+// prune forgets files not observed since before, such as files that have
+// been submitted or removed.
+func (c *stabilityCheck) prune(before time.Time) {
+	if c == nil {
+		return
+	}
+	for path, o := range c.observations {
+		if o.seen.Before(before) {
+			delete(c.observations, path)
+		}
+	}
+}
+
+// openForWrite returns the paths of regular files that any visible process has
+// open for writing, according to /proc/<pid>/fd and /proc/<pid>/fdinfo.
+// Processes of other users are only visible when running as root.
+func openForWrite() map[string]bool {
+	out := make(map[string]bool)
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		log.Printf("[converter] list open files: %v", err)
+		return out
+	}
+	for _, p := range procs {
+		if _, err := strconv.Atoi(p.Name()); err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", p.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue // exited, or not ours to inspect
+		}
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(target, "/") {
+				continue // sockets, pipes, anon inodes
+			}
+			if fdWritable(filepath.Join("/proc", p.Name(), "fdinfo", fd.Name())) {
+				out[target] = true
+			}
+		}
+	}
+	return out
+}
+
+// fdWritable reports whether the fdinfo file shows an O_WRONLY or O_RDWR
+// descriptor.
+func fdWritable(fdinfo string) bool {
+	b, err := os.ReadFile(fdinfo)
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		val, ok := strings.CutPrefix(line, "flags:")
+		if !ok {
+			continue
+		}
+		flags, err := strconv.ParseUint(strings.TrimSpace(val), 8, 64)
+		return err == nil && flags&uint64(os.O_WRONLY|os.O_RDWR) != 0
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHeldFileStaysSettled(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.ts")
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newStabilityCheck(&stabilityConfig{Scans: 2}, nil)
+	now := time.Now()
+
+	c.beginBatch(true)
+	if c.settled(path, now) {
+		t.Fatal("settled after one scan, want two")
+	}
+	c.beginBatch(true)
+	if !c.settled(path, now.Add(time.Second)) {
+		t.Fatal("not settled after two scans")
+	}
+	// The file was held rather than submitted; the next scan sees it again.
+	c.beginBatch(true)
+	if !c.settled(path, now.Add(2*time.Second)) {
+		t.Fatal("a settled file has to pass again after being held")
+	}
+
+	// A change starts over.
+	if err := os.WriteFile(path, []byte("more data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.beginBatch(true)
+	if c.settled(path, now.Add(3*time.Second)) {
+		t.Fatal("settled right after a change")
+	}
+}
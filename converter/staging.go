@@ -0,0 +1,110 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// stagingPath returns the temporary path a command writes to before its output
+// is renamed onto target. The name is derived from target alone so that crash
+// recovery can find leftovers, and keeps target's extension because ffmpeg
+// picks the muxer from it. An empty dir stages next to target.
+func stagingPath(target, dir string) string {
+	return hiddenPath(target, dir, ".partial", filepath.Ext(target))
+}
+
+// hiddenExcludes keep the scanner and watcher away from the files hiddenPath
+// names, which are half-written while a conversion runs and may match the
+// input patterns when targets live inside a scanned tree.
+var hiddenExcludes = []string{".*.partial*", ".*.step[0-9]*"}
+
+// hiddenPath returns the path of a hidden file named after target,
+// ".<basename><tag><ext>", in dir or, if dir is empty, next to target. In a
+// shared dir the name also carries a hash of target's full path, so targets
+// with the same basename in different directories do not collide.
+func hiddenPath(target, dir, tag, ext string) string {
+	name := filepath.Base(target)
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if dir == "" {
+		dir = filepath.Dir(target)
+	} else {
+		sum := sha256.Sum256([]byte(filepath.Clean(target)))
+		base += "." + hex.EncodeToString(sum[:6])
+	}
+	return filepath.Join(dir, "."+base+tag+ext)
+}
+
+// commitStaged fsyncs tmp and atomically renames it onto target. When tmp is
+// on another filesystem it is first copied next to target so the final step
+// is still a same-directory rename.
+func commitStaged(tmp, target string) error {
+	if err := syncFile(tmp); err != nil {
+		return fmt.Errorf("sync %s: %w", tmp, err)
+	}
+	err := os.Rename(tmp, target)
+	if errors.Is(err, syscall.EXDEV) {
+		local := stagingPath(target, "")
+		if err := copyFile(tmp, local); err != nil {
+			os.Remove(local)
+			return fmt.Errorf("copy %s: %w", tmp, err)
+		}
+		if err = os.Rename(local, target); err != nil {
+			os.Remove(local)
+			return fmt.Errorf("rename %s: %w", local, err)
+		}
+		os.Remove(tmp)
+	} else if err != nil {
+		return fmt.Errorf("rename %s: %w", tmp, err)
+	}
+	return syncDir(filepath.Dir(target))
+}
+
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return f.Sync()
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return fmt.Errorf("sync dir %s: %w", dir, err)
+	}
+	return nil
+}
+
+// copyFile copies src to dst and fsyncs dst.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
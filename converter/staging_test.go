@@ -0,0 +1,59 @@
+package converter
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/whisper-darkly/sticky-converter/internal/scanner"
+)
+
+func TestStagingPathSameBasename(t *testing.T) {
+	a := stagingPath("/out/a/cam1.mp4", "/staging")
+	b := stagingPath("/out/b/cam1.mp4", "/staging")
+	if a == b {
+		t.Fatalf("targets with the same basename share staging path %s", a)
+	}
+	for _, p := range []string{a, b} {
+		if filepath.Dir(p) != "/staging" || filepath.Ext(p) != ".mp4" {
+			t.Errorf("staging path %s: want a .mp4 file in /staging", p)
+		}
+	}
+	if again := stagingPath("/out/a/cam1.mp4", "/staging"); again != a {
+		t.Errorf("staging path not stable: %s, then %s", a, again)
+	}
+}
+
+func TestStagingPathNextToTarget(t *testing.T) {
+	if got, want := stagingPath("/out/a/cam1.mp4", ""), "/out/a/.cam1.partial.mp4"; got != want {
+		t.Errorf("stagingPath without staging_dir = %s, want %s", got, want)
+	}
+}
+
+func TestScanSkipsStagedAndStepFiles(t *testing.T) {
+	dir := t.TempDir()
+	h := newTestHandler(t, dir, map[string]any{
+		"target":      map[string]any{"format": "{{.File.Dir}}/{{.File.Basename}}.out.ts"},
+		"staging_dir": dir,
+	})
+	input := filepath.Join(dir, "a.ts")
+	staged := []string{
+		stagingPath(filepath.Join(dir, "a.out.ts"), ""),
+		stagingPath(filepath.Join(dir, "a.out.ts"), dir),
+		hiddenPath(filepath.Join(dir, "a.out.ts"), "", ".step1", ".ts"),
+		hiddenPath(filepath.Join(dir, "a.out.ts"), dir, ".step2", ".ts"),
+	}
+	for _, p := range append([]string{input}, staged...) {
+		if err := os.WriteFile(p, []byte("data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	paths, err := scanner.ScanAll(h.cfg.Paths, h.scanOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(paths, []string{input}) {
+		t.Fatalf("scan found %v, want only %s", paths, input)
+	}
+}
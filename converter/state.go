@@ -0,0 +1,125 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Pipeline states, stored in pipeline_config.state.
+const (
+	pipelineRunning  = "running"  // scan and submit as usual
+	pipelinePaused   = "paused"   // submit nothing; tasks already submitted still run
+	pipelineDraining = "draining" // submit nothing and refuse submitted tasks; paused once nothing is in_flight
+)
+
+var pipelineStates = []string{pipelineRunning, pipelinePaused, pipelineDraining}
+
+// state returns the pipeline's state. It is read from the database each time,
+// so processes sharing one database agree on it.
+func (h *converterHandler) state() string {
+	state, err := h.store.GetPipelineState(h.actionName)
+	if err != nil {
+		log.Printf("[converter] read pipeline state: %v", err)
+		return pipelineRunning
+	}
+	return state
+}
+
+// setState changes the pipeline's state. Back to running, a scan starts right
+// away instead of at the next scan_interval.
+func (h *converterHandler) setState(state string) error {
+	if !slices.Contains(pipelineStates, state) {
+		return fmt.Errorf("state must be one of %s, got %q", strings.Join(pipelineStates, ", "), state)
+	}
+	if err := h.store.SetPipelineState(h.actionName, state); err != nil {
+		return err
+	}
+	log.Printf("[converter] pipeline %s is now %s", h.actionName, state)
+	switch state {
+	case pipelineRunning:
+		select {
+		case h.rescan <- struct{}{}:
+		default: // a scan is already pending
+		}
+	case pipelineDraining:
+		h.finishDrain()
+	}
+	return nil
+}
+
+// finishDrain pauses a draining pipeline once nothing is in_flight.
+func (h *converterHandler) finishDrain() {
+	ok, err := h.store.FinishDrain(h.actionName)
+	if err != nil {
+		log.Printf("[converter] finish drain: %v", err)
+	} else if ok {
+		log.Printf("[converter] pipeline %s drained; now paused", h.actionName)
+	}
+}
+
+type stateJSON struct {
+	Pipeline   string `json:"pipeline"`
+	State      string `json:"state"`
+	InSchedule bool   `json:"in_schedule"` // inside a schedule window, or no schedule
+	InFlight   int    `json:"in_flight"`
+}
+
+func (h *converterHandler) stateJSON() (stateJSON, error) {
+	st, err := h.store.GetPipelineStats(h.actionName)
+	if err != nil {
+		return stateJSON{}, err
+	}
+	return stateJSON{
+		Pipeline:   h.actionName,
+		State:      h.state(),
+		InSchedule: h.schedule.open(time.Now()),
+		InFlight:   st.InFlight,
+	}, nil
+}
+
+// getState serves GET /pipelines/{name}/state.
+func (s *apiServer) getState(w http.ResponseWriter, r *http.Request) {
+	h := s.pipeline(w, r)
+	if h == nil {
+		return
+	}
+	writeState(w, h)
+}
+
+// putState serves PUT /pipelines/{name}/state.
+func (s *apiServer) putState(w http.ResponseWriter, r *http.Request) {
+	h := s.pipeline(w, r)
+	if h == nil {
+		return
+	}
+	var body struct {
+		State string `json:"state"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("body must be a JSON object: %w", err))
+		return
+	}
+	if !slices.Contains(pipelineStates, body.State) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("state must be one of %s", strings.Join(pipelineStates, ", ")))
+		return
+	}
+	if err := h.setState(body.State); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeState(w, h)
+}
+
+func writeState(w http.ResponseWriter, h *converterHandler) {
+	st, err := h.stateJSON()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
@@ -0,0 +1,106 @@
+package converter
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stepConfig is one command in a chained pipeline. Each step reads the
+// previous step's output as {{.Input}} ({{.Source}} is always the original
+// file) and the last step writes the target.
+type stepConfig struct {
+	Name    string `json:"name,omitempty"`
+	Command string `json:"command"`
+	Ext     string `json:"ext,omitempty"` // extension of the intermediate output (default: the target's)
+}
+
+// chained reports whether the pipeline runs a steps list.
+func (h *converterHandler) chained() bool { return len(h.cfg.Steps) > 0 }
+
+// stepLabel names step i for logs and error messages.
+func (h *converterHandler) stepLabel(i int) string {
+	label := fmt.Sprintf("step %d/%d", i+1, len(h.cfg.Steps))
+	if name := h.cfg.Steps[i].Name; name != "" {
+		label += " (" + name + ")"
+	}
+	return label
+}
+
+// stepPath returns where step i writes its intermediate output for target: a
+// hidden file in staging_dir (or next to target), named from target alone so
+// recovery and retries can find it. See hiddenPath.
+func (h *converterHandler) stepPath(target string, i int) string {
+	ext := filepath.Ext(target)
+	if e := h.cfg.Steps[i].Ext; e != "" {
+		ext = e
+	}
+	return hiddenPath(target, h.cfg.StagingDir, fmt.Sprintf(".step%d", i+1), ext)
+}
+
+// resumeStep returns the step to run next for inputPath. A chain resumes after
+// its last completed step as long as that step's output is still there, and
+// starts over otherwise.
+func (h *converterHandler) resumeStep(inputPath, target string) int {
+	tf, err := h.store.GetByPath(inputPath)
+	if err != nil || tf.Step <= 0 || tf.Step >= len(h.cfg.Steps) {
+		return 0
+	}
+	if _, err := os.Stat(h.stepPath(target, tf.Step-1)); err != nil {
+		log.Printf("[converter] %s: output of %s is gone; restarting the chain", inputPath, h.stepLabel(tf.Step-1))
+		return 0
+	}
+	return tf.Step
+}
+
+// advanceStep records that step i of inputPath succeeded, drops the
+// intermediate it consumed, and requeues the input for the next step.
+func (h *converterHandler) advanceStep(inputPath, target string, i int) {
+	if i > 0 {
+		h.removeStepOutput(target, i-1)
+	}
+	if err := h.store.SetStep(inputPath, i+1); err != nil {
+		log.Printf("[converter] record step %s: %v", inputPath, err)
+	}
+	if err := h.store.ResetInFlight(inputPath, "queued", ""); err != nil {
+		log.Printf("[converter] requeue %s: %v", inputPath, err)
+	}
+	log.Printf("[converter] %s: %s done", inputPath, h.stepLabel(i))
+}
+
+// removeIntermediates deletes every intermediate output of inputPath and
+// resets its chain to the first step.
+func (h *converterHandler) removeIntermediates(inputPath string) {
+	if !h.chained() {
+		return
+	}
+	target, err := h.renderTargets(inputPath)
+	if err != nil {
+		log.Printf("[converter] render target path %s: %v", inputPath, err)
+		return
+	}
+	for i := range len(h.cfg.Steps) - 1 {
+		h.removeStepOutput(target[0], i)
+	}
+	if err := h.store.SetStep(inputPath, 0); err != nil {
+		log.Printf("[converter] record step %s: %v", inputPath, err)
+	}
+}
+
+func (h *converterHandler) removeStepOutput(target string, i int) {
+	path := h.stepPath(target, i)
+	if err := removeFileWithRetry(path, 4, 250*time.Millisecond); err != nil {
+		log.Printf("[converter] remove intermediate %s: %v", path, err)
+	}
+}
+
+// wakeUp asks RunService to look at path again without waiting for the next
+// scan, so the next step of a chain or output of a pipeline starts promptly.
+func (h *converterHandler) wakeUp(path string) {
+	select {
+	case h.wake <- path:
+	default: // the next scan will pick it up
+	}
+}
@@ -0,0 +1,49 @@
+package converter
+
+import (
+	"strings"
+	"sync"
+)
+
+// lineTail keeps the last n non-empty lines of a worker's output. Carriage
+// returns count as line breaks so ffmpeg's in-place progress updates do not
+// collapse into one enormous line.
+type lineTail struct {
+	mu    sync.Mutex
+	n     int
+	lines []string
+}
+
+func newLineTail(n int) *lineTail {
+	return &lineTail{n: n}
+}
+
+// Add records a chunk of output. Each chunk is treated as one or more complete
+// lines, matching how overseer delivers worker output.
+func (t *lineTail) Add(chunk string) {
+	if t == nil || t.n <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, line := range strings.FieldsFunc(chunk, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		t.lines = append(t.lines, line)
+	}
+	if over := len(t.lines) - t.n; over > 0 {
+		t.lines = append(t.lines[:0], t.lines[over:]...)
+	}
+}
+
+// String returns the retained lines joined by newlines.
+func (t *lineTail) String() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.Join(t.lines, "\n")
+}
@@ -0,0 +1,69 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"github.com/whisper-darkly/sticky-converter/internal/probe"
+)
+
+// verifyConfig describes the checks an output must pass before its input is
+// marked completed.
+type verifyConfig struct {
+	MinSize           int64    `json:"min_size,omitempty"`           // bytes (default 1: non-empty)
+	VideoStreams      int      `json:"video_streams,omitempty"`      // minimum number of video streams
+	AudioStreams      int      `json:"audio_streams,omitempty"`      // minimum number of audio streams
+	DurationTolerance duration `json:"duration_tolerance,omitempty"` // max |output - input| duration (0 = not checked)
+}
+
+// needsProbe reports whether any check requires running ffprobe.
+func (v *verifyConfig) needsProbe() bool {
+	return v.VideoStreams > 0 || v.AudioStreams > 0 || v.DurationTolerance.Duration > 0
+}
+
+// verifyOutput checks outputPath against v and returns a descriptive error for
+// the first failed check.
+func (h *converterHandler) verifyOutput(v *verifyConfig, inputPath, outputPath string) error {
+	fi, err := os.Stat(outputPath)
+	if err != nil {
+		return fmt.Errorf("output missing: %w", err)
+	}
+	minSize := v.MinSize
+	if minSize <= 0 {
+		minSize = 1
+	}
+	if fi.Size() < minSize {
+		return fmt.Errorf("output is %d bytes, want at least %d", fi.Size(), minSize)
+	}
+	if !v.needsProbe() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	out, err := probe.Probe(ctx, h.cfg.FFprobe, outputPath)
+	if err != nil {
+		return err
+	}
+	if n := out.Count("video"); n < v.VideoStreams {
+		return fmt.Errorf("output has %d video streams, want at least %d", n, v.VideoStreams)
+	}
+	if n := out.Count("audio"); n < v.AudioStreams {
+		return fmt.Errorf("output has %d audio streams, want at least %d", n, v.AudioStreams)
+	}
+
+	if tol := v.DurationTolerance.Duration; tol > 0 {
+		in, err := probe.Probe(ctx, h.cfg.FFprobe, inputPath)
+		if err != nil {
+			return err
+		}
+		diff := math.Abs(out.Duration - in.Duration)
+		if diff > tol.Seconds() {
+			return fmt.Errorf("output duration %.2fs differs from input %.2fs by more than %s", out.Duration, in.Duration, tol)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package converter
+
+import (
+	"log"
+	"time"
+
+	"github.com/whisper-darkly/sticky-converter/internal/scanner"
+)
+
+// fileWatch batches the paths reported by a scanner.Watcher. Paths are
+// checked once no new event has arrived for the debounce period (or at most
+// ten periods after the first one), and files still younger than min_age are
+// held until they come of age. All methods are safe on a nil *fileWatch, whose
+// channels never fire.
+type fileWatch struct {
+	watcher  *scanner.Watcher
+	debounce time.Duration
+	pending  map[string]bool
+	since    time.Time // first event of the current batch
+	timer    *time.Timer
+}
+
+// startWatcher returns a fileWatch over h.cfg.Paths, or nil if watching is
+// disabled or unavailable.
+func (h *converterHandler) startWatcher() *fileWatch {
+	if !h.cfg.Watch {
+		return nil
+	}
+	w, err := scanner.NewWatcher(h.cfg.Paths, h.scanOptions())
+	if err != nil {
+		log.Printf("[converter] filesystem watch unavailable, relying on scan_interval: %v", err)
+		return nil
+	}
+	timer := time.NewTimer(time.Hour)
+	timer.Stop()
+	return &fileWatch{
+		watcher:  w,
+		debounce: h.cfg.WatchDebounce.Duration,
+		pending:  make(map[string]bool),
+		timer:    timer,
+	}
+}
+
+// Events delivers paths reported by the watcher.
+func (w *fileWatch) Events() <-chan string {
+	if w == nil {
+		return nil
+	}
+	return w.watcher.Events()
+}
+
+// Overflow fires when events were lost and a full scan is needed.
+func (w *fileWatch) Overflow() <-chan struct{} {
+	if w == nil {
+		return nil
+	}
+	return w.watcher.Overflow()
+}
+
+// Due fires when the pending paths should be checked with ready.
+func (w *fileWatch) Due() <-chan time.Time {
+	if w == nil {
+		return nil
+	}
+	return w.timer.C
+}
+
+// add records path and restarts the debounce period.
+func (w *fileWatch) add(path string) {
+	now := time.Now()
+	if len(w.pending) == 0 {
+		w.since = now
+	}
+	w.pending[path] = true
+	delay := w.debounce
+	if limit := w.since.Add(10 * w.debounce).Sub(now); limit < delay {
+		delay = limit
+	}
+	w.timer.Reset(delay)
+}
+
+// ready returns the pending paths that pass the scanner filters, sorted by
+// opts.Direction, and keeps the ones still younger than opts.MinAge for later.
+func (w *fileWatch) ready(patterns []string, opts scanner.Options) []string {
+	paths := make([]string, 0, len(w.pending))
+	for path := range w.pending {
+		paths = append(paths, path)
+	}
+	ready, young, retryAt := scanner.Filter(patterns, paths, opts)
+
+	w.pending = make(map[string]bool, len(young))
+	for _, path := range young {
+		w.pending[path] = true
+	}
+	w.since = time.Now()
+	if len(young) > 0 {
+		w.timer.Reset(time.Until(retryAt))
+	}
+	return ready
+}
+
+// Close stops the watcher.
+func (w *fileWatch) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.timer.Stop()
+	return w.watcher.Close()
+}
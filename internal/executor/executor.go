@@ -4,46 +4,127 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"text/template"
+	"time"
 )
 
 // FileVars holds the path components available in command/target templates.
 type FileVars struct {
-	Dir      string // directory containing the file
-	Name     string // full filename (base + ext)
-	Basename string // filename without extension
-	Ext      string // file extension including leading dot
+	Dir      string    // directory containing the file
+	Name     string    // full filename (base + ext)
+	Basename string    // filename without extension
+	Ext      string    // file extension including leading dot
+	Path     string    // absolute path
+	Size     int64     // size in bytes (0 if the file cannot be read)
+	ModTime  time.Time // modification time (zero if the file cannot be read)
+	Parent   string    // name of the containing directory
+	RelPath  string    // path relative to the glob base (see WithBase)
+	RelDir   string    // directory relative to the glob base, "." at the base
+	Dirs     []string  // segments of RelDir, empty at the base
 }
 
-// NewFileVars populates FileVars from an absolute path.
+// NewFileVars populates FileVars from an absolute path. The relative fields
+// are relative to the file's own directory until WithBase is called.
 func NewFileVars(absPath string) FileVars {
 	name := filepath.Base(absPath)
 	ext := filepath.Ext(name)
-	return FileVars{
-		Dir:      filepath.Dir(absPath),
+	dir := filepath.Dir(absPath)
+	fv := FileVars{
+		Dir:      dir,
 		Name:     name,
 		Basename: strings.TrimSuffix(name, ext),
 		Ext:      ext,
+		Path:     absPath,
+		Parent:   filepath.Base(dir),
 	}
+	if fi, err := os.Stat(absPath); err == nil {
+		fv.Size = fi.Size()
+		fv.ModTime = fi.ModTime()
+	}
+	return fv.WithBase(dir)
+}
+
+// WithBase returns fv with RelPath, RelDir, and Dirs relative to base, which
+// must contain the file.
+func (fv FileVars) WithBase(base string) FileVars {
+	rel, err := filepath.Rel(base, fv.Path)
+	if err != nil {
+		rel = fv.Name
+	}
+	fv.RelPath = rel
+	fv.RelDir = filepath.Dir(rel)
+	fv.Dirs = nil
+	if fv.RelDir != "." {
+		fv.Dirs = strings.Split(fv.RelDir, string(filepath.Separator))
+	}
+	return fv
+}
+
+// Extra is the merged extra map. It prints as JSON, so {{.Extra}} renders the
+// whole map while {{.Extra.key}} reads a single value.
+type Extra map[string]any
+
+// String returns e as compact JSON.
+func (e Extra) String() string {
+	if e == nil {
+		return "{}"
+	}
+	b, err := json.Marshal(map[string]any(e))
+	if err != nil {
+		return "{}"
+	}
+	return string(b)
+}
+
+// ParseExtra decodes a JSON object into an Extra.
+func ParseExtra(extraJSON string) (Extra, error) {
+	e := Extra{}
+	if extraJSON == "" {
+		return e, nil
+	}
+	if err := json.Unmarshal([]byte(extraJSON), &e); err != nil {
+		return nil, fmt.Errorf("parse extra: %w", err)
+	}
+	return e, nil
 }
 
 // TemplateData is the data available inside command and target templates.
 type TemplateData struct {
-	Input  string
-	Output string
-	Extra  string // JSON-encoded merged extra map
-	File   FileVars
+	Input    string
+	Output   string
+	Extra    Extra          // merged extra map
+	File     FileVars       // components of Source
+	Source   string         // original input file; differs from Input in later steps of a chain
+	Pipeline string         // name of the pipeline (action)
+	Probe    map[string]any // ffprobe results of Source (see probe.Result.Vars); nil unless probing
+	Task     TaskVars       // params of a manual start; zero for scanner tasks
+}
+
+// TaskVars holds the optional params a manual start passed for one task.
+type TaskVars struct {
+	Target   string         // output path replacing the rendered target, "" if not set
+	Priority int            // niceness of the worker process, 0 if not set
+	Force    bool           // converting again despite completed status or conflicts
+	Extra    map[string]any // overrides merged over extra, as passed
 }
 
 // RenderTargetPath derives the output path for inputPath using the pipeline's
 // target regex (optional named groups) and format template.
 func RenderTargetPath(inputPath, regexStr, formatTmpl string) (string, error) {
-	fv := NewFileVars(inputPath)
+	return RenderTarget(regexStr, formatTmpl, NewFileVars(inputPath), "")
+}
+
+// RenderTarget is RenderTargetPath for a prepared FileVars, with pipeline
+// available as {{.Pipeline}}.
+func RenderTarget(regexStr, formatTmpl string, fv FileVars, pipeline string) (string, error) {
+	inputPath := fv.Path
 	data := map[string]any{
-		"File": fv,
+		"File":     fv,
+		"Pipeline": pipeline,
 	}
 
 	if regexStr != "" {
@@ -61,7 +142,7 @@ func RenderTargetPath(inputPath, regexStr, formatTmpl string) (string, error) {
 		}
 	}
 
-	tmpl, err := template.New("target").Parse(formatTmpl)
+	tmpl, err := template.New("target").Funcs(Funcs).Parse(formatTmpl)
 	if err != nil {
 		return "", fmt.Errorf("parse target template: %w", err)
 	}
@@ -96,14 +177,25 @@ func MergeExtra(base map[string]any, overrideJSON string) (string, error) {
 
 // RenderCommand renders the command template and splits it into argv.
 func RenderCommand(cmdTmpl, inputPath, outputPath, extraJSON string) ([]string, error) {
+	extra, err := ParseExtra(extraJSON)
+	if err != nil {
+		return nil, err
+	}
 	fv := NewFileVars(inputPath)
 	data := TemplateData{
 		Input:  inputPath,
 		Output: outputPath,
-		Extra:  extraJSON,
+		Extra:  extra,
 		File:   fv,
+		Source: inputPath,
 	}
-	tmpl, err := template.New("cmd").Parse(cmdTmpl)
+	return RenderCommandData(cmdTmpl, data)
+}
+
+// RenderCommandData renders the command template with data and splits it into
+// argv.
+func RenderCommandData(cmdTmpl string, data TemplateData) ([]string, error) {
+	tmpl, err := template.New("cmd").Funcs(Funcs).Parse(cmdTmpl)
 	if err != nil {
 		return nil, fmt.Errorf("parse command template: %w", err)
 	}
@@ -114,12 +206,14 @@ func RenderCommand(cmdTmpl, inputPath, outputPath, extraJSON string) ([]string,
 	return parseArgs(buf.String()), nil
 }
 
-// parseArgs splits a command string into argv respecting quoted strings.
+// parseArgs splits a command string into argv respecting quoted strings. A
+// quoted empty string (” or "") is kept as an empty argument.
 // Ported from chaturbate-dvr/server/converter.go.
 func parseArgs(s string) []string {
 	var args []string
 	var current strings.Builder
 	inQuote := false
+	quoted := false // the current argument contains a quoted part
 	quoteChar := rune(0)
 
 	runes := []rune(s)
@@ -128,14 +222,16 @@ func parseArgs(s string) []string {
 		switch {
 		case (r == '"' || r == '\'') && !inQuote:
 			inQuote = true
+			quoted = true
 			quoteChar = r
 		case r == quoteChar && inQuote:
 			inQuote = false
 			quoteChar = 0
 		case r == ' ' && !inQuote:
-			if current.Len() > 0 {
+			if current.Len() > 0 || quoted {
 				args = append(args, current.String())
 				current.Reset()
+				quoted = false
 			}
 		case r == '\\' && i+1 < len(runes):
 			next := runes[i+1]
@@ -149,7 +245,7 @@ func parseArgs(s string) []string {
 			current.WriteRune(r)
 		}
 	}
-	if current.Len() > 0 {
+	if current.Len() > 0 || quoted {
 		args = append(args, current.String())
 	}
 	return args
@@ -0,0 +1,35 @@
+package executor
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"ffmpeg -i in.ts out.mp4", []string{"ffmpeg", "-i", "in.ts", "out.mp4"}},
+		{`ffmpeg -i "my file.ts"  out.mp4`, []string{"ffmpeg", "-i", "my file.ts", "out.mp4"}},
+		{`cmd '' b`, []string{"cmd", "", "b"}},
+		{`cmd "" b ''`, []string{"cmd", "", "b", ""}},
+		{`cmd a'b c'd`, []string{"cmd", "ab cd"}},
+		{`cmd 'it\'s'`, []string{"cmd", "it's"}},
+	}
+	for _, tt := range tests {
+		if got := parseArgs(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("parseArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestShellquoteEmptyArgument(t *testing.T) {
+	got, err := RenderCommandData(`cmd {{shellquote "" "a b"}} last`, TemplateData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cmd", "", "a b", "last"}; !slices.Equal(got, want) {
+		t.Errorf("rendered %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Funcs are the helper functions available in command and target templates.
+// Argument order follows Sprig, so the value being transformed comes last and
+// can be piped in: {{.File.Basename | replace " " "_" | lower}}.
+var Funcs = template.FuncMap{
+	"date":       date,
+	"now":        time.Now,
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"default":    defaultValue,
+	"shellquote": shellquote,
+	"join":       join,
+}
+
+// date formats t with a Go reference-time layout, e.g. "2006/01/02".
+func date(layout string, t time.Time) string {
+	return t.Format(layout)
+}
+
+// defaultValue returns v, or def if v is missing or the zero value of its
+// type, so {{.Extra.crf | default 23}} falls back when crf is unset.
+func defaultValue(def, v any) any {
+	if v == nil {
+		return def
+	}
+	if rv := reflect.ValueOf(v); rv.IsZero() {
+		return def
+	}
+	return v
+}
+
+// join joins path elements with filepath.Join. String slices such as
+// .File.Dirs are spread, so {{join "/archive" .File.Dirs .File.Name}} works.
+func join(elems ...any) string {
+	var parts []string
+	for _, e := range elems {
+		switch e := e.(type) {
+		case []string:
+			parts = append(parts, e...)
+		default:
+			parts = append(parts, fmt.Sprint(e))
+		}
+	}
+	return filepath.Join(parts...)
+}
+
+// shellquote quotes each argument so the command splitter keeps it as a
+// single argv entry whatever spaces or quotes it contains, and joins them
+// with spaces. Arguments without backslashes or single quotes come out
+// quoted the way a POSIX shell would read them too.
+func shellquote(args ...string) string {
+	quoted := make([]string, len(args))
+	for i, a := range args {
+		a = strings.ReplaceAll(a, `\`, `\\`)
+		a = strings.ReplaceAll(a, `'`, `\'`)
+		quoted[i] = "'" + a + "'"
+	}
+	return strings.Join(quoted, " ")
+}
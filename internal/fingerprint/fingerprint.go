@@ -0,0 +1,68 @@
+// Package fingerprint identifies file contents cheaply enough to check on
+// every scan.
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// sampleSize is the number of bytes hashed from each sampled region.
+const sampleSize = 64 * 1024
+
+// Fingerprint describes a file's contents at one point in time.
+type Fingerprint struct {
+	Size    int64
+	ModTime time.Time
+	Hash    string // hex SHA-256 of samples; empty unless requested
+}
+
+// Of stats path and, with hash set, hashes samples of its contents.
+func Of(path string, hash bool) (*Fingerprint, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	fp := &Fingerprint{Size: fi.Size(), ModTime: fi.ModTime()}
+	if hash {
+		if fp.Hash, err = SampleHash(path, fi.Size()); err != nil {
+			return nil, err
+		}
+	}
+	return fp, nil
+}
+
+// SampleHash hashes size together with the first, middle, and last 64 KiB of
+// path, so that appended or rewritten recordings change it without the whole
+// file being read. Files up to three samples long are hashed in full.
+func SampleHash(path string, size int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	var sizeBuf [8]byte
+	binary.BigEndian.PutUint64(sizeBuf[:], uint64(size))
+	h.Write(sizeBuf[:])
+
+	offsets := []int64{0}
+	length := int64(sampleSize)
+	if size <= 3*sampleSize {
+		length = size
+	} else {
+		offsets = append(offsets, size/2-sampleSize/2, size-sampleSize)
+	}
+	for _, off := range offsets {
+		if _, err := io.Copy(h, io.NewSectionReader(f, off, length)); err != nil {
+			return "", fmt.Errorf("hash %s: %w", path, err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,167 @@
+// Package probe reads media properties with ffprobe.
+package probe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Stream describes one stream reported by ffprobe.
+type Stream struct {
+	Index        int    `json:"index"`
+	CodecType    string `json:"codec_type"` // "video", "audio", "subtitle", ...
+	CodecName    string `json:"codec_name"`
+	Profile      string `json:"profile"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+	PixFmt       string `json:"pix_fmt"`
+	AvgFrameRate string `json:"avg_frame_rate"` // "30000/1001"
+	Channels     int    `json:"channels"`
+	SampleRate   string `json:"sample_rate"`
+	BitRate      string `json:"bit_rate"`
+	Duration     string `json:"duration"`
+}
+
+// Result is the subset of ffprobe's JSON output sticky-converter uses.
+type Result struct {
+	Duration float64 // seconds; 0 if unknown
+	BitRate  int64   // overall bits per second; 0 if unknown
+	Format   string  // container format name, e.g. "mpegts"
+	Streams  []Stream
+}
+
+// ffprobeOutput mirrors `ffprobe -print_format json -show_format -show_streams`.
+type ffprobeOutput struct {
+	Format struct {
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+		FormatName string `json:"format_name"`
+	} `json:"format"`
+	Streams []Stream `json:"streams"`
+}
+
+// Probe runs ffprobe (ffprobePath, or "ffprobe" if empty) against path.
+func Probe(ctx context.Context, ffprobePath, path string) (*Result, error) {
+	if ffprobePath == "" {
+		ffprobePath = "ffprobe"
+	}
+	cmd := exec.CommandContext(ctx, ffprobePath,
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format", "-show_streams",
+		path,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("ffprobe %s: %w: %s", path, err, msg)
+		}
+		return nil, fmt.Errorf("ffprobe %s: %w", path, err)
+	}
+
+	var raw ffprobeOutput
+	if err := json.Unmarshal(out, &raw); err != nil {
+		return nil, fmt.Errorf("parse ffprobe output: %w", err)
+	}
+	res := &Result{
+		Duration: parseFloat(raw.Format.Duration),
+		BitRate:  parseInt(raw.Format.BitRate),
+		Format:   raw.Format.FormatName,
+		Streams:  raw.Streams,
+	}
+	return res, nil
+}
+
+// First returns the first stream of codecType, or nil.
+func (r *Result) First(codecType string) *Stream {
+	for i := range r.Streams {
+		if r.Streams[i].CodecType == codecType {
+			return &r.Streams[i]
+		}
+	}
+	return nil
+}
+
+// Vars returns the result as a map for templates and rule expressions:
+// duration, bitrate, format, the first video and audio stream as video and
+// audio (empty maps if there is none), and every stream under streams.
+func (r *Result) Vars() map[string]any {
+	streams := make([]any, len(r.Streams))
+	for i := range r.Streams {
+		streams[i] = r.Streams[i].vars()
+	}
+	vars := map[string]any{
+		"duration": r.Duration,
+		"bitrate":  r.BitRate,
+		"format":   r.Format,
+		"video":    map[string]any{},
+		"audio":    map[string]any{},
+		"streams":  streams,
+	}
+	if s := r.First("video"); s != nil {
+		vars["video"] = s.vars()
+	}
+	if s := r.First("audio"); s != nil {
+		vars["audio"] = s.vars()
+	}
+	return vars
+}
+
+// vars returns the stream's properties, with numbers parsed.
+func (s *Stream) vars() map[string]any {
+	return map[string]any{
+		"index":       int64(s.Index),
+		"type":        s.CodecType,
+		"codec":       s.CodecName,
+		"profile":     s.Profile,
+		"width":       int64(s.Width),
+		"height":      int64(s.Height),
+		"pix_fmt":     s.PixFmt,
+		"fps":         parseRate(s.AvgFrameRate),
+		"channels":    int64(s.Channels),
+		"sample_rate": parseInt(s.SampleRate),
+		"bitrate":     parseInt(s.BitRate),
+		"duration":    parseFloat(s.Duration),
+	}
+}
+
+// parseRate parses a frame rate like "30000/1001"; 0 if unknown.
+func parseRate(s string) float64 {
+	num, den, ok := strings.Cut(s, "/")
+	if !ok {
+		return parseFloat(s)
+	}
+	d := parseFloat(den)
+	if d == 0 {
+		return 0
+	}
+	return parseFloat(num) / d
+}
+
+func parseFloat(s string) float64 {
+	f, _ := strconv.ParseFloat(s, 64)
+	return f
+}
+
+func parseInt(s string) int64 {
+	n, _ := strconv.ParseInt(s, 10, 64)
+	return n
+}
+
+// Count returns the number of streams of codecType.
+func (r *Result) Count(codecType string) int {
+	n := 0
+	for _, s := range r.Streams {
+		if s.CodecType == codecType {
+			n++
+		}
+	}
+	return n
+}
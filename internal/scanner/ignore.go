@@ -0,0 +1,225 @@
+package scanner
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// IgnoreFileName is the per-directory ignore file honoured by the scanner.
+// Its rules use gitignore syntax and apply to the directory's contents.
+const IgnoreFileName = ".stickyignore"
+
+// ignoreRule is one gitignore-style pattern.
+type ignoreRule struct {
+	pattern  string
+	negate   bool // "!pattern" re-includes a path excluded by an earlier rule
+	dirOnly  bool // "pattern/" matches directories only
+	anchored bool // contains a slash: matched against the whole relative path, not the basename
+}
+
+// parseRule parses one line of an ignore file or one exclude pattern.
+func parseRule(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	var r ignoreRule
+	switch {
+	case strings.HasPrefix(line, "!"):
+		r.negate = true
+		line = line[1:]
+	case strings.HasPrefix(line, `\`):
+		line = line[1:] // \# and \! match literally
+	}
+	if strings.HasSuffix(line, "/") {
+		r.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		r.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	r.pattern = line
+	return r, true
+}
+
+func parseRules(lines []string) []ignoreRule {
+	var rules []ignoreRule
+	for _, line := range lines {
+		if r, ok := parseRule(line); ok {
+			rules = append(rules, r)
+		}
+	}
+	return rules
+}
+
+// match reports whether rel, relative to the directory the rule belongs to,
+// matches the rule.
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	if !r.anchored {
+		rel = path.Base(rel)
+	}
+	m, _ := doublestar.Match(r.pattern, rel)
+	return m
+}
+
+// dirInfo is what the excluder knows about one directory.
+type dirInfo struct {
+	marker bool         // holds an ExcludeIfPresent marker
+	rules  []ignoreRule // from its IgnoreFileName
+}
+
+// excluder applies Options.Exclude, Options.ExcludeIfPresent, and ignore
+// files. It caches per-directory state and is meant to live for one scan, so
+// edits to ignore files are picked up by the next one.
+type excluder struct {
+	rules       []ignoreRule
+	markers     []string
+	dirs        map[string]*dirInfo
+	dirExcluded map[string]bool // base + "\x00" + dir → excluded
+}
+
+func newExcluder(opts Options) *excluder {
+	return &excluder{
+		rules:       parseRules(opts.Exclude),
+		markers:     opts.ExcludeIfPresent,
+		dirs:        make(map[string]*dirInfo),
+		dirExcluded: make(map[string]bool),
+	}
+}
+
+// excluded reports whether abs, below the glob base, is excluded either
+// itself or through one of its parent directories. As with gitignore, a file
+// inside an excluded directory cannot be re-included.
+func (e *excluder) excluded(base, abs string, isDir bool) bool {
+	rel, err := filepath.Rel(base, abs)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return false
+	}
+	if parent := filepath.Dir(abs); parent != base {
+		key := base + "\x00" + parent
+		ex, ok := e.dirExcluded[key]
+		if !ok {
+			ex = e.excluded(base, parent, true)
+			e.dirExcluded[key] = ex
+		}
+		if ex {
+			return true
+		}
+	}
+
+	if isDir && e.dir(abs).marker {
+		return true
+	}
+	ignored := false
+	for _, r := range e.rules {
+		if r.match(rel, isDir) {
+			ignored = !r.negate
+		}
+	}
+	// Ignore files from the base down to the parent; deeper rules win.
+	var chain []string
+	for d := filepath.Dir(abs); ; d = filepath.Dir(d) {
+		chain = append(chain, d)
+		if d == base || d == filepath.Dir(d) {
+			break
+		}
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		d := chain[i]
+		rules := e.dir(d).rules
+		if len(rules) == 0 {
+			continue
+		}
+		relD, _ := filepath.Rel(d, abs)
+		for _, r := range rules {
+			if r.match(relD, isDir) {
+				ignored = !r.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// dir returns what is known about dir, reading its marker and ignore files on
+// first use.
+func (e *excluder) dir(dir string) *dirInfo {
+	if info, ok := e.dirs[dir]; ok {
+		return info
+	}
+	info := &dirInfo{}
+	for _, m := range e.markers {
+		if _, err := os.Lstat(filepath.Join(dir, m)); err == nil {
+			info.marker = true
+			break
+		}
+	}
+	info.rules = readIgnoreFile(filepath.Join(dir, IgnoreFileName))
+	e.dirs[dir] = info
+	return info
+}
+
+// prime records dir's marker and ignore files from a directory listing, which
+// saves a stat per file name on the walk.
+func (e *excluder) prime(dir string, entries []fs.DirEntry) {
+	if _, ok := e.dirs[dir]; ok {
+		return
+	}
+	info := &dirInfo{}
+	for _, ent := range entries {
+		name := ent.Name()
+		if name == IgnoreFileName {
+			info.rules = readIgnoreFile(filepath.Join(dir, name))
+		}
+		for _, m := range e.markers {
+			if name == m {
+				info.marker = true
+			}
+		}
+	}
+	e.dirs[dir] = info
+}
+
+func readIgnoreFile(path string) []ignoreRule {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return parseRules(strings.Split(string(b), "\n"))
+}
+
+// pruneFS hides excluded entries from doublestar.GlobWalk, so excluded
+// directories are never read.
+type pruneFS struct {
+	fs.FS
+	base string
+	ex   *excluder
+}
+
+func (f *pruneFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := fs.ReadDir(f.FS, name)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(f.base, filepath.FromSlash(name))
+	f.ex.prime(dir, entries)
+	out := entries[:0]
+	for _, ent := range entries {
+		if !f.ex.excluded(f.base, filepath.Join(dir, ent.Name()), ent.IsDir()) {
+			out = append(out, ent)
+		}
+	}
+	return out, nil
+}
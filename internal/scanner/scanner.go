@@ -2,9 +2,11 @@ package scanner
 
 import (
 	"io/fs"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/bmatcuk/doublestar/v4"
@@ -13,26 +15,39 @@ import (
 type fileEntry struct {
 	path    string
 	modTime time.Time
+	size    int64
 }
 
-// ScanAll walks all glob patterns, applies min/max age filters, and returns
-// matched file paths sorted by direction ("oldest" first or "newest" first).
-// Zero-value minAge or maxAge means no limit.
-func ScanAll(patterns []string, direction string, minAge, maxAge time.Duration) ([]string, error) {
+// Options controls which files ScanAll and Filter return and in what order.
+type Options struct {
+	Direction        string        // "oldest" (default), "newest", "smallest", "largest", "path", or "random"
+	MinAge           time.Duration // skip files modified more recently (0 = no limit)
+	MaxAge           time.Duration // skip files modified longer ago (0 = no limit)
+	MinSize          int64         // skip smaller files, in bytes (0 = no limit)
+	MaxSize          int64         // skip larger files, in bytes (0 = no limit)
+	Exclude          []string      // gitignore-style patterns, relative to each glob base
+	ExcludeIfPresent []string      // marker file names that exclude their directory
+}
+
+// ScanAll walks all glob patterns, applies the filters in opts, and returns
+// matched file paths sorted by opts.Direction. Excluded and ignored
+// directories are not descended into.
+func ScanAll(patterns []string, opts Options) ([]string, error) {
 	now := time.Now()
+	ex := newExcluder(opts)
 	seen := make(map[string]bool)
 	var entries []fileEntry
 
 	for _, pattern := range patterns {
 		base, rel := splitPattern(pattern)
-		fsys := os.DirFS(base)
+		fsys := &pruneFS{FS: os.DirFS(base), base: base, ex: ex}
 
 		err := doublestar.GlobWalk(fsys, rel, func(path string, d fs.DirEntry) error {
 			if d.IsDir() {
 				return nil
 			}
 			absPath := filepath.Join(base, path)
-			if seen[absPath] {
+			if seen[absPath] || ex.excluded(base, absPath, false) {
 				return nil
 			}
 
@@ -42,15 +57,18 @@ func ScanAll(patterns []string, direction string, minAge, maxAge time.Duration)
 			}
 			age := now.Sub(info.ModTime())
 
-			if minAge > 0 && age < minAge {
+			if opts.MinAge > 0 && age < opts.MinAge {
 				return nil
 			}
-			if maxAge > 0 && age > maxAge {
+			if opts.MaxAge > 0 && age > opts.MaxAge {
+				return nil
+			}
+			if !opts.sizeOK(info.Size()) {
 				return nil
 			}
 
 			seen[absPath] = true
-			entries = append(entries, fileEntry{path: absPath, modTime: info.ModTime()})
+			entries = append(entries, fileEntry{path: absPath, modTime: info.ModTime(), size: info.Size()})
 			return nil
 		})
 		if err != nil {
@@ -58,18 +76,115 @@ func ScanAll(patterns []string, direction string, minAge, maxAge time.Duration)
 		}
 	}
 
-	sort.SliceStable(entries, func(i, j int) bool {
-		if direction == "newest" {
-			return entries[i].modTime.After(entries[j].modTime)
+	sortEntries(entries, opts.Direction)
+	return entryPaths(entries), nil
+}
+
+// Filter stats paths, drops those that are gone, excluded, outside the size
+// limits, or older than opts.MaxAge, and returns the rest that are at least opts.MinAge old sorted
+// like ScanAll. Paths that are still too young are returned in young, with
+// retryAt the earliest time one of them reaches opts.MinAge.
+func Filter(patterns, paths []string, opts Options) (ready, young []string, retryAt time.Time) {
+	now := time.Now()
+	ex := newExcluder(opts)
+	var entries []fileEntry
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() {
+			continue
+		}
+		if base, _, ok := RelativeTo(patterns, path); !ok || ex.excluded(base, path, false) {
+			continue
+		}
+		if !opts.sizeOK(info.Size()) {
+			continue
 		}
-		return entries[i].modTime.Before(entries[j].modTime)
-	})
+		age := now.Sub(info.ModTime())
+		if opts.MinAge > 0 && age < opts.MinAge {
+			young = append(young, path)
+			if due := info.ModTime().Add(opts.MinAge); retryAt.IsZero() || due.Before(retryAt) {
+				retryAt = due
+			}
+			continue
+		}
+		if opts.MaxAge > 0 && age > opts.MaxAge {
+			continue
+		}
+		entries = append(entries, fileEntry{path: path, modTime: info.ModTime(), size: info.Size()})
+	}
+	sortEntries(entries, opts.Direction)
+	return entryPaths(entries), young, retryAt
+}
+
+// Directions accepted by Options.Direction.
+var Directions = []string{"oldest", "newest", "smallest", "largest", "path", "random"}
+
+func sortEntries(entries []fileEntry, direction string) {
+	var less func(a, b fileEntry) bool
+	switch direction {
+	case "newest":
+		less = func(a, b fileEntry) bool { return a.modTime.After(b.modTime) }
+	case "smallest":
+		less = func(a, b fileEntry) bool { return a.size < b.size }
+	case "largest":
+		less = func(a, b fileEntry) bool { return a.size > b.size }
+	case "path":
+		less = func(a, b fileEntry) bool { return a.path < b.path }
+	case "random":
+		rand.Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+		return
+	default:
+		less = func(a, b fileEntry) bool { return a.modTime.Before(b.modTime) }
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return less(entries[i], entries[j]) })
+}
 
+// sizeOK reports whether size is within MinSize and MaxSize.
+func (o Options) sizeOK(size int64) bool {
+	return (o.MinSize <= 0 || size >= o.MinSize) && (o.MaxSize <= 0 || size <= o.MaxSize)
+}
+
+func entryPaths(entries []fileEntry) []string {
 	paths := make([]string, len(entries))
 	for i, e := range entries {
 		paths[i] = e.path
 	}
-	return paths, nil
+	return paths
+}
+
+// Match reports whether path matches any of the glob patterns.
+func Match(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		base, rel := splitPattern(pattern)
+		r, err := filepath.Rel(base, path)
+		if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if match, _ := doublestar.Match(rel, filepath.ToSlash(r)); match {
+			return true
+		}
+	}
+	return false
+}
+
+// RelativeTo finds the pattern that matches path and returns that pattern's
+// static base directory and path relative to it. When no pattern matches,
+// the longest base containing path is used; ok is false if there is none.
+func RelativeTo(patterns []string, path string) (base, rel string, ok bool) {
+	for _, pattern := range patterns {
+		b, relPattern := splitPattern(pattern)
+		r, err := filepath.Rel(b, path)
+		if err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+			continue
+		}
+		if match, _ := doublestar.Match(relPattern, filepath.ToSlash(r)); match {
+			return b, r, true
+		}
+		if len(b) > len(base) {
+			base, rel, ok = b, r, true
+		}
+	}
+	return base, rel, ok
 }
 
 // splitPattern separates an absolute glob pattern like /recordings/**/*.ts into
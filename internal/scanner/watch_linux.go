@@ -0,0 +1,172 @@
+package scanner
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// watchMask selects the inotify events that can make a file ready: written and
+// closed, moved in, or newly created (directories are then watched too).
+const watchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF | syscall.IN_ONLYDIR
+
+// Watcher reports files below the static bases of a set of glob patterns as
+// they are created, closed after writing, or moved in. Every directory below
+// each base that is not excluded by opts is watched with inotify.
+type Watcher struct {
+	patterns []string
+	opts     Options
+	fd       int
+	file     *os.File // wraps fd so reads use the runtime poller and Close unblocks them
+	events   chan string
+	overflow chan struct{}
+
+	mu   sync.Mutex
+	dirs map[int32]string // watch descriptor → directory
+}
+
+// NewWatcher starts watching the bases of patterns. Directories that cannot be
+// watched (for example once fs.inotify.max_user_watches is exhausted) are
+// logged and left to the periodic scan.
+func NewWatcher(patterns []string, opts Options) (*Watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &Watcher{
+		patterns: patterns,
+		opts:     opts,
+		fd:       fd,
+		file:     os.NewFile(uintptr(fd), "inotify"),
+		events:   make(chan string, 4096),
+		overflow: make(chan struct{}, 1),
+		dirs:     make(map[int32]string),
+	}
+	for _, pattern := range patterns {
+		base, _ := splitPattern(pattern)
+		w.addTree(base, base, false)
+	}
+	go w.readLoop()
+	return w, nil
+}
+
+// Events delivers paths of files that match a pattern and may have become
+// ready. A path can be reported more than once.
+func (w *Watcher) Events() <-chan string { return w.events }
+
+// Overflow is signalled when events were lost, either by the kernel or because
+// Events was not drained. A full scan is needed to catch up.
+func (w *Watcher) Overflow() <-chan struct{} { return w.overflow }
+
+// Close stops the watcher and closes Events.
+func (w *Watcher) Close() error { return w.file.Close() }
+
+// addTree watches dir and every directory below it that is not excluded
+// relative to base. With emit set, files already present are reported, since
+// they may have been created before the watch was in place.
+func (w *Watcher) addTree(base, dir string, emit bool) {
+	ex := newExcluder(w.opts)
+	_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ex.excluded(base, path, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			if emit {
+				w.emit(path)
+			}
+			return nil
+		}
+		wd, err := syscall.InotifyAddWatch(w.fd, path, watchMask)
+		if err != nil {
+			log.Printf("[scanner] watch %s: %v", path, err)
+			if errors.Is(err, syscall.ENOSPC) {
+				return filepath.SkipAll
+			}
+			return nil
+		}
+		w.mu.Lock()
+		w.dirs[int32(wd)] = path
+		w.mu.Unlock()
+		return nil
+	})
+}
+
+func (w *Watcher) readLoop() {
+	defer close(w.events)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Printf("[scanner] read inotify events: %v", err)
+			}
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+			nameBytes := buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(ev.Len)]
+			off += syscall.SizeofInotifyEvent + int(ev.Len)
+			w.handle(ev.Wd, ev.Mask, strings.TrimRight(string(nameBytes), "\x00"))
+		}
+	}
+}
+
+func (w *Watcher) handle(wd int32, mask uint32, name string) {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.signalOverflow()
+		return
+	}
+	w.mu.Lock()
+	dir, ok := w.dirs[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+	}
+	w.mu.Unlock()
+	if !ok || name == "" {
+		return
+	}
+
+	path := filepath.Join(dir, name)
+	if mask&syscall.IN_ISDIR != 0 {
+		if mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+			if base, _, ok := RelativeTo(w.patterns, path); ok {
+				w.addTree(base, path, true)
+			}
+		}
+		return
+	}
+	if mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO|syscall.IN_CREATE) != 0 {
+		w.emit(path)
+	}
+}
+
+func (w *Watcher) emit(path string) {
+	if !Match(w.patterns, path) {
+		return
+	}
+	select {
+	case w.events <- path:
+	default:
+		w.signalOverflow()
+	}
+}
+
+func (w *Watcher) signalOverflow() {
+	select {
+	case w.overflow <- struct{}{}:
+	default:
+	}
+}
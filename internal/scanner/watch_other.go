@@ -0,0 +1,17 @@
+//go:build !linux
+
+package scanner
+
+import "errors"
+
+// Watcher is only implemented on Linux.
+type Watcher struct{}
+
+// NewWatcher always fails: filesystem watching needs inotify.
+func NewWatcher(patterns []string, opts Options) (*Watcher, error) {
+	return nil, errors.New("filesystem watching is only supported on Linux")
+}
+
+func (w *Watcher) Events() <-chan string     { return nil }
+func (w *Watcher) Overflow() <-chan struct{} { return nil }
+func (w *Watcher) Close() error              { return nil }
@@ -2,8 +2,13 @@ package store
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/whisper-darkly/sticky-converter/internal/fingerprint"
 )
 
 // schema defines the sticky-converter database tables.
@@ -17,7 +22,57 @@ CREATE TABLE IF NOT EXISTS target_files (
 	queued_at         TEXT,
 	started_at        TEXT,
 	completed_at      TEXT,
-	last_attempted_at TEXT
+	last_attempted_at TEXT,
+	boot_id           TEXT,
+	heartbeat_at      TEXT,
+	progress_percent  REAL,
+	progress_out_ms   INTEGER,
+	progress_fps      REAL,
+	progress_speed    REAL,
+	progress_eta_ms   INTEGER,
+	progress_at       TEXT,
+	target_path       TEXT,
+	source_size       INTEGER,
+	source_mtime      TEXT,
+	source_hash       TEXT,
+	current_step      INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS target_outputs (
+	path          TEXT NOT NULL,
+	output_name   TEXT NOT NULL,
+	status        TEXT NOT NULL DEFAULT 'queued',
+	output_path   TEXT,
+	error_count   INTEGER NOT NULL DEFAULT 0,
+	error_message TEXT,
+	started_at    TEXT,
+	completed_at  TEXT,
+	PRIMARY KEY (path, output_name)
+);
+
+CREATE TABLE IF NOT EXISTS conversion_attempts (
+	path          TEXT NOT NULL,
+	attempt       INTEGER NOT NULL,
+	task_id       TEXT,
+	argv_json     TEXT NOT NULL DEFAULT '[]',
+	output_path   TEXT,
+	started_at    TEXT NOT NULL,
+	ended_at      TEXT,
+	exit_code     INTEGER,
+	intentional   INTEGER NOT NULL DEFAULT 0,
+	output_size   INTEGER,
+	stderr_tail   TEXT,
+	error_message TEXT,
+	step          INTEGER,
+	PRIMARY KEY (path, attempt)
+);
+
+CREATE TABLE IF NOT EXISTS pending_deletions (
+	path          TEXT PRIMARY KEY,
+	pipeline_name TEXT NOT NULL,
+	mod_time      TEXT NOT NULL,
+	delete_after  TEXT NOT NULL,
+	created_at    TEXT NOT NULL
 );
 
 CREATE TABLE IF NOT EXISTS pipeline_config (
@@ -26,6 +81,46 @@ CREATE TABLE IF NOT EXISTS pipeline_config (
 );
 `
 
+// columnMigrations lists columns added after the initial schema. SQLite has no
+// ADD COLUMN IF NOT EXISTS, so each is applied only when missing from an
+// existing database.
+var columnMigrations = []struct {
+	table, column, def string
+}{
+	{"target_files", "boot_id", "TEXT"},
+	{"target_files", "heartbeat_at", "TEXT"},
+	{"target_files", "progress_percent", "REAL"},
+	{"target_files", "progress_out_ms", "INTEGER"},
+	{"target_files", "progress_fps", "REAL"},
+	{"target_files", "progress_speed", "REAL"},
+	{"target_files", "progress_eta_ms", "INTEGER"},
+	{"target_files", "progress_at", "TEXT"},
+	{"target_files", "target_path", "TEXT"},
+	{"target_files", "source_size", "INTEGER"},
+	{"target_files", "source_mtime", "TEXT"},
+	{"target_files", "source_hash", "TEXT"},
+	{"target_files", "current_step", "INTEGER NOT NULL DEFAULT 0"},
+	{"conversion_attempts", "step", "INTEGER"},
+	{"pipeline_config", "state", "TEXT NOT NULL DEFAULT 'running'"},
+	{"target_files", "hold_reason", "TEXT"},
+	{"target_files", "replacing", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+// indexes are created after columnMigrations, since they may cover migrated
+// columns.
+var indexes = []string{
+	`CREATE INDEX IF NOT EXISTS target_files_source ON target_files (pipeline_name, source_size)`,
+}
+
+// targetFileColumns is the column list read by scanTargetFile.
+const targetFileColumns = `path, pipeline_name, status, error_count, COALESCE(error_message,''),
+	COALESCE(queued_at,''), COALESCE(started_at,''), COALESCE(completed_at,''), COALESCE(last_attempted_at,''),
+	COALESCE(boot_id,''), COALESCE(heartbeat_at,''),
+	progress_percent, progress_out_ms, progress_fps, progress_speed, progress_eta_ms, COALESCE(progress_at,''),
+	COALESCE(target_path,''),
+	source_size, COALESCE(source_mtime,''), COALESCE(source_hash,''),
+	current_step, COALESCE(hold_reason,''), replacing`
+
 // Store is the sticky-converter data access layer.
 type Store struct {
 	db *sql.DB
@@ -36,9 +131,48 @@ func New(db *sql.DB) (*Store, error) {
 	if _, err := db.Exec(schema); err != nil {
 		return nil, fmt.Errorf("apply schema: %w", err)
 	}
+	for _, m := range columnMigrations {
+		if err := addColumnIfMissing(db, m.table, m.column, m.def); err != nil {
+			return nil, fmt.Errorf("migrate %s.%s: %w", m.table, m.column, err)
+		}
+	}
+	for _, idx := range indexes {
+		if _, err := db.Exec(idx); err != nil {
+			return nil, fmt.Errorf("create index: %w", err)
+		}
+	}
 	return &Store{db: db}, nil
 }
 
+func addColumnIfMissing(db *sql.DB, table, column, def string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			cid     int
+			name    string
+			typ     string
+			notNull int
+			dflt    sql.NullString
+			pk      int
+		)
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, def))
+	return err
+}
+
 // DB returns the underlying *sql.DB for sharing with overseer.
 func (s *Store) DB() *sql.DB { return s.db }
 
@@ -53,27 +187,232 @@ type TargetFile struct {
 	StartedAt       *time.Time
 	CompletedAt     *time.Time
 	LastAttemptedAt *time.Time
+	BootID          string                   // process that last marked the file in_flight
+	HeartbeatAt     *time.Time               // last liveness update from BootID
+	Progress        *Progress                // latest progress of the current or last run; nil if none reported
+	TargetPath      string                   // rendered output path at the last scan
+	Source          *fingerprint.Fingerprint // input as last queued or started; nil if never recorded
+	Step            int                      // index of the next step to run in a chained pipeline
+	HoldReason      string                   // why a queued file is not being started, e.g. "waiting for disk"
+	Replacing       bool                     // a new version of the input, whose previous outputs it may overwrite
 }
 
-// UpsertQueued inserts or re-queues a target file.
-func (s *Store) UpsertQueued(path, pipeline string) error {
+// Progress is the latest progress reported by a running conversion.
+type Progress struct {
+	Percent   float64       // 0–100; 0 if the input duration is unknown
+	OutTime   time.Duration // media time written so far
+	FPS       float64
+	Speed     float64       // multiple of real time
+	ETA       time.Duration // 0 if unknown
+	UpdatedAt time.Time
+}
+
+// UpsertQueued inserts or re-queues a target file and records the output
+// path it renders to and, if src is not nil, the input's fingerprint.
+func (s *Store) UpsertQueued(path, pipeline, targetPath string, src *fingerprint.Fingerprint) error {
+	size, mtime, hash := sourceArgs(src)
 	_, err := s.db.Exec(`
-		INSERT INTO target_files (path, pipeline_name, status, queued_at)
-		VALUES (?, ?, 'queued', ?)
+		INSERT INTO target_files (path, pipeline_name, status, queued_at, target_path, source_size, source_mtime, source_hash)
+		VALUES (?, ?, 'queued', ?, ?, ?, ?, ?)
 		ON CONFLICT(path) DO UPDATE SET
 			status = CASE WHEN excluded.status = 'queued' THEN 'queued' ELSE status END,
-			queued_at = CASE WHEN status = 'errored' OR status = 'paused' THEN ? ELSE queued_at END
-	`, path, pipeline, now(), now())
+			queued_at = CASE WHEN status = 'errored' OR status = 'paused' THEN ? ELSE queued_at END,
+			target_path = excluded.target_path,
+			source_size = COALESCE(excluded.source_size, source_size),
+			source_mtime = COALESCE(excluded.source_mtime, source_mtime),
+			source_hash = CASE WHEN excluded.source_size IS NULL THEN source_hash ELSE excluded.source_hash END
+	`, path, pipeline, now(), targetPath, size, mtime, hash, now())
+	return err
+}
+
+// SetSource records the fingerprint of the input about to be converted.
+func (s *Store) SetSource(path string, src *fingerprint.Fingerprint) error {
+	size, mtime, hash := sourceArgs(src)
+	_, err := s.db.Exec(`
+		UPDATE target_files SET source_size = ?, source_mtime = ?, source_hash = ?
+		WHERE path = ?
+	`, size, mtime, hash, path)
+	return err
+}
+
+// RequeueNewVersion resets a completed or failed file whose input has been
+// replaced, and forgets its outputs, so it is converted again from a clean
+// slate. The file is marked Replacing until it completes, since the outputs
+// of the previous version are its own to overwrite.
+func (s *Store) RequeueNewVersion(path string) error {
+	_, err := s.requeue(path, true)
+	return err
+}
+
+// Requeue resets a file that is not in_flight to a clean queued state: its
+// error count, chain step, and outputs are forgotten. It reports whether the
+// file was reset.
+func (s *Store) Requeue(path string) (bool, error) {
+	return s.requeue(path, false)
+}
+
+func (s *Store) requeue(path string, replacing bool) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`
+		UPDATE target_files
+		SET status = 'queued', queued_at = ?, error_count = 0, error_message = NULL,
+		    started_at = NULL, completed_at = NULL, last_attempted_at = NULL, current_step = 0,
+		    replacing = ?
+		WHERE path = ? AND status != 'in_flight'
+	`, now(), replacing, path)
+	if err != nil {
+		return false, err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+	if _, err := tx.Exec(`DELETE FROM target_outputs WHERE path = ?`, path); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// SetStep records the index of the next step to run for path.
+func (s *Store) SetStep(path string, step int) error {
+	_, err := s.db.Exec(`UPDATE target_files SET current_step = ? WHERE path = ?`, step, path)
+	return err
+}
+
+// ListCompletedBySource returns the completed files of pipeline whose recorded
+// input had the given size and mtime.
+func (s *Store) ListCompletedBySource(pipeline string, size int64, modTime time.Time) ([]*TargetFile, error) {
+	rows, err := s.db.Query(`SELECT `+targetFileColumns+`
+		FROM target_files
+		WHERE pipeline_name = ? AND source_size = ? AND source_mtime = ? AND status = 'completed'
+	`, pipeline, size, formatTime(modTime))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*TargetFile
+	for rows.Next() {
+		tf, err := scanTargetFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, tf)
+	}
+	return out, rows.Err()
+}
+
+// TargetClaim is another file's claim on a target path.
+type TargetClaim struct {
+	Path   string
+	Status string // "in_flight" or "queued"
+}
+
+// TargetClaims returns the other files whose claim on targetPath comes before
+// path's, by path. An in_flight file always owns its targets; among queued
+// files the lowest path wins, so colliding files never hold each other. Both
+// single targets and the outputs of multi-output pipelines are considered.
+func (s *Store) TargetClaims(targetPath, path string) ([]TargetClaim, error) {
+	rows, err := s.db.Query(`
+		SELECT f.path, f.status FROM target_files f
+		WHERE f.path != ?
+		  AND (f.target_path = ? OR EXISTS (
+		      SELECT 1 FROM target_outputs o WHERE o.path = f.path AND o.output_path = ?))
+		  AND (f.status = 'in_flight' OR (f.status = 'queued' AND f.path < ?))
+		ORDER BY f.path
+	`, path, targetPath, targetPath, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var claims []TargetClaim
+	for rows.Next() {
+		var c TargetClaim
+		if err := rows.Scan(&c.Path, &c.Status); err != nil {
+			return nil, err
+		}
+		claims = append(claims, c)
+	}
+	return claims, rows.Err()
+}
+
+// MarkInFlight marks a task as in_flight and records bootID as its owner.
+func (s *Store) MarkInFlight(path, bootID string) error {
+	_, err := s.db.Exec(`
+		UPDATE target_files
+		SET status = 'in_flight', started_at = ?, last_attempted_at = ?, boot_id = ?, heartbeat_at = ?, hold_reason = NULL,
+		    progress_percent = NULL, progress_out_ms = NULL, progress_fps = NULL,
+		    progress_speed = NULL, progress_eta_ms = NULL, progress_at = NULL
+		WHERE path = ?
+	`, now(), now(), bootID, now(), path)
 	return err
 }
 
-// MarkInFlight marks a task as in_flight.
-func (s *Store) MarkInFlight(path string) error {
+// SetHoldReason records why a queued file is held back; "" clears it.
+func (s *Store) SetHoldReason(path, reason string) error {
+	_, err := s.db.Exec(`UPDATE target_files SET hold_reason = ? WHERE path = ?`, nullIfEmpty(reason), path)
+	return err
+}
+
+// UpdateProgress stores the latest progress for an in_flight file.
+func (s *Store) UpdateProgress(path string, p Progress) error {
 	_, err := s.db.Exec(`
 		UPDATE target_files
-		SET status = 'in_flight', started_at = ?, last_attempted_at = ?
+		SET progress_percent = ?, progress_out_ms = ?, progress_fps = ?, progress_speed = ?,
+		    progress_eta_ms = ?, progress_at = ?
 		WHERE path = ?
-	`, now(), now(), path)
+	`, p.Percent, p.OutTime.Milliseconds(), p.FPS, p.Speed, p.ETA.Milliseconds(), now(), path)
+	return err
+}
+
+// Heartbeat refreshes heartbeat_at on every in_flight row owned by bootID.
+func (s *Store) Heartbeat(bootID string) error {
+	_, err := s.db.Exec(`
+		UPDATE target_files SET heartbeat_at = ?
+		WHERE status = 'in_flight' AND boot_id = ?
+	`, now(), bootID)
+	return err
+}
+
+// ListOrphaned returns the in_flight rows of pipeline that are not owned by
+// bootID and whose last heartbeat is older than staleBefore. Rows with no
+// owner or heartbeat are always considered orphaned.
+func (s *Store) ListOrphaned(pipeline, bootID string, staleBefore time.Time) ([]*TargetFile, error) {
+	rows, err := s.db.Query(`SELECT `+targetFileColumns+`
+		FROM target_files
+		WHERE pipeline_name = ? AND status = 'in_flight' AND COALESCE(boot_id,'') != ?
+	`, pipeline, bootID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*TargetFile
+	for rows.Next() {
+		tf, err := scanTargetFile(rows)
+		if err != nil {
+			return nil, err
+		}
+		if tf.BootID != "" && tf.HeartbeatAt != nil && tf.HeartbeatAt.After(staleBefore) {
+			continue
+		}
+		out = append(out, tf)
+	}
+	return out, rows.Err()
+}
+
+// ResetInFlight moves an in_flight row to status ("queued" or "errored") with
+// message. error_count is incremented only for "errored". Rows that are no
+// longer in_flight are left untouched.
+func (s *Store) ResetInFlight(path, status, message string) error {
+	_, err := s.db.Exec(`
+		UPDATE target_files
+		SET status = ?, error_message = ?, boot_id = NULL, heartbeat_at = NULL,
+		    error_count = error_count + CASE WHEN ? = 'errored' THEN 1 ELSE 0 END,
+		    queued_at = CASE WHEN ? = 'queued' THEN ? ELSE queued_at END
+		WHERE path = ? AND status = 'in_flight'
+	`, status, message, status, status, now(), path)
 	return err
 }
 
@@ -81,7 +420,7 @@ func (s *Store) MarkInFlight(path string) error {
 func (s *Store) MarkCompleted(path string) error {
 	_, err := s.db.Exec(`
 		UPDATE target_files
-		SET status = 'completed', completed_at = ?
+		SET status = 'completed', completed_at = ?, replacing = 0
 		WHERE path = ?
 	`, now(), path)
 	return err
@@ -97,6 +436,13 @@ func (s *Store) MarkErrored(path, message string) error {
 	return err
 }
 
+// MarkFailed moves an errored file to the terminal 'failed' status. Failed
+// files are never re-queued by the scanner.
+func (s *Store) MarkFailed(path string) error {
+	_, err := s.db.Exec(`UPDATE target_files SET status = 'failed' WHERE path = ?`, path)
+	return err
+}
+
 // IsCompleted returns true if the file at path has status 'completed'.
 func (s *Store) IsCompleted(path string) bool {
 	tf, err := s.GetByPath(path)
@@ -111,33 +457,124 @@ func (s *Store) IsInFlight(path string) bool {
 
 // MarkPaused sets status to paused.
 func (s *Store) MarkPaused(path string) error {
-	_, err := s.db.Exec(`UPDATE target_files SET status = 'paused' WHERE path = ?`, path)
-	return err
-}
-
-// MarkResumed clears paused/errored status back to queued.
-func (s *Store) MarkResumed(path string) error {
 	_, err := s.db.Exec(`
-		UPDATE target_files SET status = 'queued', error_message = NULL WHERE path = ?
+		UPDATE target_files SET status = 'paused', boot_id = NULL, heartbeat_at = NULL WHERE path = ?
 	`, path)
 	return err
 }
 
+// PauseWaiting pauses a queued or errored file and reports whether it did.
+// Paused files are left alone by the scanner until resumed.
+func (s *Store) PauseWaiting(path string) (bool, error) {
+	return s.affected(s.db.Exec(`
+		UPDATE target_files SET status = 'paused' WHERE path = ? AND status IN ('queued', 'errored')
+	`, path))
+}
+
+// MarkResumed clears paused/errored/failed status back to queued, keeping
+// the error count, and reports whether it did.
+func (s *Store) MarkResumed(path string) (bool, error) {
+	return s.affected(s.db.Exec(`
+		UPDATE target_files SET status = 'queued', queued_at = ?, error_message = NULL
+		WHERE path = ? AND status IN ('paused', 'errored', 'failed')
+	`, now(), path))
+}
+
+// affected reports whether an Exec changed any row.
+func (s *Store) affected(res sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
 // GetByPath returns the TargetFile for path, or sql.ErrNoRows.
 func (s *Store) GetByPath(path string) (*TargetFile, error) {
-	row := s.db.QueryRow(`
-		SELECT path, pipeline_name, status, error_count, COALESCE(error_message,''),
-		       COALESCE(queued_at,''), COALESCE(started_at,''), COALESCE(completed_at,''), COALESCE(last_attempted_at,'')
-		FROM target_files WHERE path = ?
-	`, path)
+	row := s.db.QueryRow(`SELECT `+targetFileColumns+` FROM target_files WHERE path = ?`, path)
 	return scanTargetFile(row)
 }
 
+// TaskQuery selects, sorts, and pages files for QueryTasks.
+type TaskQuery struct {
+	Pipeline   string
+	Statuses   []string // any of these; empty matches every status
+	PathPrefix string
+	MinErrors  int
+	MaxErrors  *int
+	Sort       string // one of TaskSortFields (default "queued_at")
+	Desc       bool
+	Limit      int // 0 means no limit
+	Offset     int
+}
+
+// TaskSortFields are the columns QueryTasks can sort by.
+var TaskSortFields = []string{"path", "status", "queued_at", "started_at", "completed_at", "last_attempted_at", "error_count"}
+
+// QueryTasks returns the files matching q and how many match in total,
+// before paging.
+func (s *Store) QueryTasks(q TaskQuery) ([]*TargetFile, int, error) {
+	where := ` WHERE pipeline_name = ?`
+	args := []any{q.Pipeline}
+	if len(q.Statuses) > 0 {
+		where += ` AND status IN (?` + strings.Repeat(`, ?`, len(q.Statuses)-1) + `)`
+		for _, st := range q.Statuses {
+			args = append(args, st)
+		}
+	}
+	if q.PathPrefix != "" {
+		where += ` AND instr(path, ?) = 1`
+		args = append(args, q.PathPrefix)
+	}
+	if q.MinErrors > 0 {
+		where += ` AND error_count >= ?`
+		args = append(args, q.MinErrors)
+	}
+	if q.MaxErrors != nil {
+		where += ` AND error_count <= ?`
+		args = append(args, *q.MaxErrors)
+	}
+
+	var total int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM target_files`+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	sort := q.Sort
+	if sort == "" {
+		sort = "queued_at"
+	}
+	if !slices.Contains(TaskSortFields, sort) {
+		return nil, 0, fmt.Errorf("cannot sort by %q", sort)
+	}
+	dir := "ASC"
+	if q.Desc {
+		dir = "DESC"
+	}
+	query := `SELECT ` + targetFileColumns + ` FROM target_files` + where +
+		` ORDER BY ` + sort + ` ` + dir + `, path ` + dir
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d OFFSET %d", q.Limit, q.Offset)
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	var out []*TargetFile
+	for rows.Next() {
+		tf, err := scanTargetFile(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		out = append(out, tf)
+	}
+	return out, total, rows.Err()
+}
+
 // ListTasks returns tasks filtered by pipeline / status with pagination.
 func (s *Store) ListTasks(pipeline, status string, limit, offset int) ([]*TargetFile, error) {
-	q := `SELECT path, pipeline_name, status, error_count, COALESCE(error_message,''),
-	             COALESCE(queued_at,''), COALESCE(started_at,''), COALESCE(completed_at,''), COALESCE(last_attempted_at,'')
-	      FROM target_files WHERE 1=1`
+	q := `SELECT ` + targetFileColumns + ` FROM target_files WHERE 1=1`
 	var args []any
 	if pipeline != "" {
 		q += " AND pipeline_name = ?"
@@ -167,6 +604,115 @@ func (s *Store) ListTasks(pipeline, status string, limit, offset int) ([]*Target
 	return out, rows.Err()
 }
 
+// TargetOutput mirrors a row in target_outputs: one output of a multi-output
+// pipeline for one input.
+type TargetOutput struct {
+	Path         string // input path
+	Name         string
+	Status       string // queued, in_flight, completed, or errored
+	OutputPath   string
+	ErrorCount   int
+	ErrorMessage string
+	StartedAt    *time.Time
+	CompletedAt  *time.Time
+}
+
+// EnsureOutput creates the target_outputs row for path and name if it is
+// missing and records the output path it renders to.
+func (s *Store) EnsureOutput(path, name, outputPath string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO target_outputs (path, output_name, output_path) VALUES (?, ?, ?)
+		ON CONFLICT(path, output_name) DO UPDATE SET output_path = excluded.output_path
+	`, path, name, outputPath)
+	return err
+}
+
+// ListOutputs returns the recorded outputs of path ordered by name.
+func (s *Store) ListOutputs(path string) ([]*TargetOutput, error) {
+	rows, err := s.db.Query(`
+		SELECT path, output_name, status, COALESCE(output_path,''), error_count,
+		       COALESCE(error_message,''), COALESCE(started_at,''), COALESCE(completed_at,'')
+		FROM target_outputs WHERE path = ? ORDER BY output_name
+	`, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*TargetOutput
+	for rows.Next() {
+		var o TargetOutput
+		var startedAt, completedAt string
+		if err := rows.Scan(&o.Path, &o.Name, &o.Status, &o.OutputPath, &o.ErrorCount,
+			&o.ErrorMessage, &startedAt, &completedAt); err != nil {
+			return nil, err
+		}
+		if startedAt != "" {
+			if t, err := parseTime(startedAt); err == nil {
+				o.StartedAt = &t
+			}
+		}
+		if completedAt != "" {
+			if t, err := parseTime(completedAt); err == nil {
+				o.CompletedAt = &t
+			}
+		}
+		out = append(out, &o)
+	}
+	return out, rows.Err()
+}
+
+// MarkOutputInFlight marks one output of path as running and records where it
+// is written.
+func (s *Store) MarkOutputInFlight(path, name, outputPath string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO target_outputs (path, output_name, status, output_path, started_at)
+		VALUES (?, ?, 'in_flight', ?, ?)
+		ON CONFLICT(path, output_name) DO UPDATE SET
+			status = 'in_flight', output_path = excluded.output_path, started_at = excluded.started_at
+	`, path, name, outputPath, now())
+	return err
+}
+
+// MarkOutputCompleted marks one output of path as completed.
+func (s *Store) MarkOutputCompleted(path, name string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO target_outputs (path, output_name, status, completed_at) VALUES (?, ?, 'completed', ?)
+		ON CONFLICT(path, output_name) DO UPDATE SET
+			status = 'completed', completed_at = excluded.completed_at, error_message = NULL
+	`, path, name, now())
+	return err
+}
+
+// MarkOutputErrored increments an output's error_count and records message.
+func (s *Store) MarkOutputErrored(path, name, message string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO target_outputs (path, output_name, status, error_count, error_message) VALUES (?, ?, 'errored', 1, ?)
+		ON CONFLICT(path, output_name) DO UPDATE SET
+			status = 'errored', error_count = error_count + 1, error_message = excluded.error_message
+	`, path, name, message)
+	return err
+}
+
+// MarkOutputQueued moves one output of path back to queued.
+func (s *Store) MarkOutputQueued(path, name string) error {
+	_, err := s.db.Exec(`
+		UPDATE target_outputs SET status = 'queued' WHERE path = ? AND output_name = ?
+	`, path, name)
+	return err
+}
+
+// ResetInFlightOutputs moves path's in_flight outputs back to status
+// ("queued" or "errored") with message.
+func (s *Store) ResetInFlightOutputs(path, status, message string) error {
+	_, err := s.db.Exec(`
+		UPDATE target_outputs
+		SET status = ?, error_message = ?,
+		    error_count = error_count + CASE WHEN ? = 'errored' THEN 1 ELSE 0 END
+		WHERE path = ? AND status = 'in_flight'
+	`, status, nullIfEmpty(message), status, path)
+	return err
+}
+
 // PipelineStats holds aggregate counts per pipeline.
 type PipelineStats struct {
 	Queued    int
@@ -174,6 +720,7 @@ type PipelineStats struct {
 	Completed int
 	Errored   int
 	Paused    int
+	Failed    int
 }
 
 // GetPipelineStats returns aggregated status counts for a pipeline.
@@ -204,11 +751,72 @@ func (s *Store) GetPipelineStats(pipeline string) (*PipelineStats, error) {
 			st.Errored = count
 		case "paused":
 			st.Paused = count
+		case "failed":
+			st.Failed = count
 		}
 	}
 	return &st, rows.Err()
 }
 
+// PendingDeletion mirrors a row in pending_deletions: a converted source file
+// to delete once its retention period ends.
+type PendingDeletion struct {
+	Path         string
+	PipelineName string
+	ModTime      time.Time // source mtime when scheduled; a changed file is not deleted
+	DeleteAfter  time.Time
+}
+
+// ScheduleDeletion records that path should be deleted after deleteAfter.
+func (s *Store) ScheduleDeletion(path, pipeline string, modTime, deleteAfter time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO pending_deletions (path, pipeline_name, mod_time, delete_after, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(path) DO UPDATE SET
+			pipeline_name = excluded.pipeline_name,
+			mod_time = excluded.mod_time,
+			delete_after = excluded.delete_after
+	`, path, pipeline, formatTime(modTime), formatTime(deleteAfter), now())
+	return err
+}
+
+// DueDeletions returns the pending deletions of pipeline whose retention has
+// ended by t.
+func (s *Store) DueDeletions(pipeline string, t time.Time) ([]*PendingDeletion, error) {
+	rows, err := s.db.Query(`
+		SELECT path, pipeline_name, mod_time, delete_after
+		FROM pending_deletions WHERE pipeline_name = ?
+	`, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*PendingDeletion
+	for rows.Next() {
+		var pd PendingDeletion
+		var modTime, deleteAfter string
+		if err := rows.Scan(&pd.Path, &pd.PipelineName, &modTime, &deleteAfter); err != nil {
+			return nil, err
+		}
+		if pd.ModTime, err = parseTime(modTime); err != nil {
+			return nil, fmt.Errorf("pending deletion %s: %w", pd.Path, err)
+		}
+		if pd.DeleteAfter, err = parseTime(deleteAfter); err != nil {
+			return nil, fmt.Errorf("pending deletion %s: %w", pd.Path, err)
+		}
+		if !pd.DeleteAfter.After(t) {
+			out = append(out, &pd)
+		}
+	}
+	return out, rows.Err()
+}
+
+// RemoveDeletion forgets a pending deletion.
+func (s *Store) RemoveDeletion(path string) error {
+	_, err := s.db.Exec(`DELETE FROM pending_deletions WHERE path = ?`, path)
+	return err
+}
+
 // GetPipelineExtra returns the stored extra_json for a pipeline (or "{}").
 func (s *Store) GetPipelineExtra(name string) (string, error) {
 	var extra string
@@ -228,6 +836,157 @@ func (s *Store) SetPipelineExtra(name, extraJSON string) error {
 	return err
 }
 
+// GetPipelineState returns a pipeline's state ("running", "paused", or
+// "draining"); "running" if it was never set.
+func (s *Store) GetPipelineState(name string) (string, error) {
+	var state string
+	err := s.db.QueryRow(`SELECT state FROM pipeline_config WHERE name = ?`, name).Scan(&state)
+	if err == sql.ErrNoRows {
+		return "running", nil
+	}
+	return state, err
+}
+
+// SetPipelineState upserts a pipeline's state.
+func (s *Store) SetPipelineState(name, state string) error {
+	_, err := s.db.Exec(`
+		INSERT INTO pipeline_config (name, state) VALUES (?, ?)
+		ON CONFLICT(name) DO UPDATE SET state = excluded.state
+	`, name, state)
+	return err
+}
+
+// FinishDrain moves a draining pipeline with nothing in_flight to paused and
+// reports whether it did.
+func (s *Store) FinishDrain(name string) (bool, error) {
+	return s.affected(s.db.Exec(`
+		UPDATE pipeline_config SET state = 'paused'
+		WHERE name = ? AND state = 'draining'
+		  AND NOT EXISTS (SELECT 1 FROM target_files WHERE pipeline_name = ? AND status = 'in_flight')
+	`, name, name))
+}
+
+// Attempt mirrors a row in conversion_attempts: one run of the command for a
+// file. EndedAt and ExitCode are nil while the attempt is running or if the
+// process died before it finished.
+type Attempt struct {
+	Path         string
+	Attempt      int
+	TaskID       string
+	Argv         []string
+	OutputPath   string
+	StartedAt    time.Time
+	EndedAt      *time.Time
+	ExitCode     *int
+	Intentional  bool
+	OutputSize   *int64
+	StderrTail   string
+	ErrorMessage string
+	Step         *int // chain step the attempt ran; nil outside chained pipelines
+}
+
+// Duration returns how long the attempt ran, or 0 if it has not ended.
+func (a *Attempt) Duration() time.Duration {
+	if a.EndedAt == nil {
+		return 0
+	}
+	return a.EndedAt.Sub(a.StartedAt)
+}
+
+// StartAttempt records the start of a new attempt for path and returns its
+// 1-based attempt number. step is the chain step being run, or -1 outside
+// chained pipelines.
+func (s *Store) StartAttempt(path, taskID string, step int, argv []string, outputPath string) (int, error) {
+	argvJSON, err := json.Marshal(argv)
+	if err != nil {
+		return 0, err
+	}
+	var stepArg any
+	if step >= 0 {
+		stepArg = step
+	}
+	var attempt int
+	err = s.db.QueryRow(`
+		INSERT INTO conversion_attempts (path, attempt, task_id, argv_json, output_path, started_at, step)
+		SELECT ?, COALESCE(MAX(attempt), 0) + 1, ?, ?, ?, ?, ?
+		FROM conversion_attempts WHERE path = ?
+		RETURNING attempt
+	`, path, taskID, string(argvJSON), outputPath, now(), stepArg, path).Scan(&attempt)
+	return attempt, err
+}
+
+// FinishAttempt records the outcome of an attempt. outputSize < 0 means the
+// output did not exist; errMsg is empty for a successful attempt.
+func (s *Store) FinishAttempt(path string, attempt, exitCode int, intentional bool, outputSize int64, stderrTail, errMsg string) error {
+	var size any
+	if outputSize >= 0 {
+		size = outputSize
+	}
+	_, err := s.db.Exec(`
+		UPDATE conversion_attempts
+		SET ended_at = ?, exit_code = ?, intentional = ?, output_size = ?, stderr_tail = ?, error_message = ?
+		WHERE path = ? AND attempt = ?
+	`, now(), exitCode, intentional, size, nullIfEmpty(stderrTail), nullIfEmpty(errMsg), path, attempt)
+	return err
+}
+
+// AbandonAttempts closes every unfinished attempt for path with message. Used
+// when recovering files whose worker died with a previous process.
+func (s *Store) AbandonAttempts(path, message string) error {
+	_, err := s.db.Exec(`
+		UPDATE conversion_attempts SET ended_at = ?, error_message = ?
+		WHERE path = ? AND ended_at IS NULL
+	`, now(), message, path)
+	return err
+}
+
+// ListAttempts returns every attempt recorded for path, oldest first.
+func (s *Store) ListAttempts(path string) ([]*Attempt, error) {
+	rows, err := s.db.Query(`
+		SELECT path, attempt, COALESCE(task_id,''), argv_json, COALESCE(output_path,''),
+		       started_at, COALESCE(ended_at,''), exit_code, intentional, output_size,
+		       COALESCE(stderr_tail,''), COALESCE(error_message,''), step
+		FROM conversion_attempts WHERE path = ? ORDER BY attempt
+	`, path)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*Attempt
+	for rows.Next() {
+		var a Attempt
+		var argvJSON, startedAt, endedAt string
+		var exitCode, outputSize, step sql.NullInt64
+		if err := rows.Scan(&a.Path, &a.Attempt, &a.TaskID, &argvJSON, &a.OutputPath,
+			&startedAt, &endedAt, &exitCode, &a.Intentional, &outputSize,
+			&a.StderrTail, &a.ErrorMessage, &step); err != nil {
+			return nil, err
+		}
+		_ = json.Unmarshal([]byte(argvJSON), &a.Argv)
+		if t, err := parseTime(startedAt); err == nil {
+			a.StartedAt = t
+		}
+		if endedAt != "" {
+			if t, err := parseTime(endedAt); err == nil {
+				a.EndedAt = &t
+			}
+		}
+		if exitCode.Valid {
+			c := int(exitCode.Int64)
+			a.ExitCode = &c
+		}
+		if outputSize.Valid {
+			a.OutputSize = &outputSize.Int64
+		}
+		if step.Valid {
+			n := int(step.Int64)
+			a.Step = &n
+		}
+		out = append(out, &a)
+	}
+	return out, rows.Err()
+}
+
 // scanner interface so scanTargetFile works for both *sql.Row and *sql.Rows.
 type scanner interface {
 	Scan(dest ...any) error
@@ -235,10 +994,18 @@ type scanner interface {
 
 func scanTargetFile(s scanner) (*TargetFile, error) {
 	var tf TargetFile
-	var queuedAt, startedAt, completedAt, lastAttemptedAt string
+	var queuedAt, startedAt, completedAt, lastAttemptedAt, heartbeatAt, progressAt string
+	var percent, fps, speed sql.NullFloat64
+	var outMS, etaMS, sourceSize sql.NullInt64
+	var sourceMtime, sourceHash string
 	err := s.Scan(
 		&tf.Path, &tf.PipelineName, &tf.Status, &tf.ErrorCount, &tf.ErrorMessage,
 		&queuedAt, &startedAt, &completedAt, &lastAttemptedAt,
+		&tf.BootID, &heartbeatAt,
+		&percent, &outMS, &fps, &speed, &etaMS, &progressAt,
+		&tf.TargetPath,
+		&sourceSize, &sourceMtime, &sourceHash,
+		&tf.Step, &tf.HoldReason, &tf.Replacing,
 	)
 	if err != nil {
 		return nil, err
@@ -261,10 +1028,52 @@ func scanTargetFile(s scanner) (*TargetFile, error) {
 			tf.LastAttemptedAt = &t
 		}
 	}
+	if heartbeatAt != "" {
+		if t, err := parseTime(heartbeatAt); err == nil {
+			tf.HeartbeatAt = &t
+		}
+	}
+	if progressAt != "" {
+		p := &Progress{
+			Percent: percent.Float64,
+			OutTime: time.Duration(outMS.Int64) * time.Millisecond,
+			FPS:     fps.Float64,
+			Speed:   speed.Float64,
+			ETA:     time.Duration(etaMS.Int64) * time.Millisecond,
+		}
+		if t, err := parseTime(progressAt); err == nil {
+			p.UpdatedAt = t
+		}
+		tf.Progress = p
+	}
+	if sourceSize.Valid {
+		src := &fingerprint.Fingerprint{Size: sourceSize.Int64, Hash: sourceHash}
+		if t, err := parseTime(sourceMtime); err == nil {
+			src.ModTime = t
+		}
+		tf.Source = src
+	}
 	return &tf, nil
 }
 
-func now() string { return time.Now().UTC().Format(time.RFC3339Nano) }
+// sourceArgs returns the source_* column values for src (all NULL if nil).
+func sourceArgs(src *fingerprint.Fingerprint) (size, mtime, hash any) {
+	if src == nil {
+		return nil, nil, nil
+	}
+	return src.Size, formatTime(src.ModTime), nullIfEmpty(src.Hash)
+}
+
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func now() string { return formatTime(time.Now()) }
+
+func formatTime(t time.Time) string { return t.UTC().Format(time.RFC3339Nano) }
 
 func parseTime(s string) (time.Time, error) {
 	return time.Parse(time.RFC3339Nano, s)
@@ -0,0 +1,29 @@
+// Package sysinfo reads the free disk space, load average, and available
+// memory that admission control compares against its thresholds.
+package sysinfo
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Disk is the space available to unprivileged users on one filesystem.
+type Disk struct {
+	ID   string // identifies the filesystem, so paths on the same one can be grouped
+	Free uint64 // bytes
+}
+
+// existingDir returns dir or its nearest ancestor that exists, so the space
+// for a target directory that is yet to be created can be checked.
+func existingDir(dir string) string {
+	for {
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
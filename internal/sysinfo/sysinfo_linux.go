@@ -0,0 +1,62 @@
+package sysinfo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// DiskFree returns the free space on the filesystem holding dir.
+func DiskFree(dir string) (Disk, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(existingDir(dir), &st); err != nil {
+		return Disk{}, err
+	}
+	return Disk{
+		ID:   fmt.Sprint(st.Fsid),
+		Free: st.Bavail * uint64(st.Bsize),
+	}, nil
+}
+
+// LoadAverage returns the one-minute load average from /proc/loadavg.
+func LoadAverage() (float64, error) {
+	b, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) == 0 {
+		return 0, errors.New("empty /proc/loadavg")
+	}
+	return strconv.ParseFloat(fields[0], 64)
+}
+
+// MemAvailable returns MemAvailable from /proc/meminfo in bytes: the memory
+// that can be used without swapping.
+func MemAvailable() (uint64, error) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		val, ok := strings.CutPrefix(sc.Text(), "MemAvailable:")
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(val), " kB"), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parse MemAvailable: %w", err)
+		}
+		return kb * 1024, nil
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	return 0, errors.New("no MemAvailable in /proc/meminfo")
+}
@@ -0,0 +1,16 @@
+//go:build !linux
+
+package sysinfo
+
+import "errors"
+
+var errUnsupported = errors.New("only supported on Linux")
+
+// DiskFree always fails: it is only implemented on Linux.
+func DiskFree(dir string) (Disk, error) { return Disk{}, errUnsupported }
+
+// LoadAverage always fails: it is only implemented on Linux.
+func LoadAverage() (float64, error) { return 0, errUnsupported }
+
+// MemAvailable always fails: it is only implemented on Linux.
+func MemAvailable() (uint64, error) { return 0, errUnsupported }